@@ -1,48 +1,474 @@
 package clients
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+type FetcherRequest struct {
+	Url string
+	// Method defaults to GET.
+	Method      string
+	Body        []byte
+	ContentType string
+	// Headers are sent with the request, on top of the ones the client sets.
+	Headers http.Header
+	// Referer, when set, is sent as the request's Referer header.
+	Referer string
+	// Cookies are sent with the request, on top of any the client keeps.
+	Cookies []*http.Cookie
+	// MaxBodyBytes, when positive, reads up to that many bytes of the response
+	// body into FetcherResponse.Body. Bodies of redirects are never read.
+	MaxBodyBytes int64
+	// BodyContentTypes, when set, restricts body reading to responses whose
+	// Content-Type is one of these media types.
+	BodyContentTypes []string
+	// BodyReadTimeout, when positive, bounds the time spent reading the body,
+	// so a slowly dripping body can't hold the hop until the request times out.
+	// The bytes read until then are kept and BodyTimedOut is set.
+	BodyReadTimeout time.Duration
+	// CaptureRequestHeaders fills FetcherResponse.RequestHeaders.
+	CaptureRequestHeaders bool
+}
+
 type FetcherResponse struct {
 	StatusCode int
-	Headers    http.Header
+	// Proto is the protocol the response came with, like "HTTP/1.1" or
+	// "HTTP/2.0".
+	Proto   string
+	Headers http.Header
+	Body    []byte
+	// BodyTimedOut reports whether reading Body was cut short by
+	// FetcherRequest.BodyReadTimeout.
+	BodyTimedOut bool
+	// HeadersTruncated reports whether headers past the client's limits were
+	// dropped from Headers, see WithMaxHeaders and WithMaxHeaderBytes.
+	HeadersTruncated bool
+	// ExpandedBy names the ShortUrlResolver that answered instead of the
+	// server, with a 301 to the url it expanded to, see WithShortUrlResolvers.
+	ExpandedBy string
+	// Waited is the time spent waiting on the per-host rate limit before the
+	// request was sent, which callers exclude from the hop's latency.
+	Waited time.Duration
+	// RequestHeaders are the headers the request was sent with, when
+	// FetcherRequest.CaptureRequestHeaders is set. Headers the transport adds
+	// on its own, like Host and Accept-Encoding, aren't included.
+	RequestHeaders http.Header
 }
 
+// FetcherClient is safe for concurrent use.
 type FetcherClient interface {
-	Fetch(context context.Context, url string) (FetcherResponse, error)
+	Fetch(context context.Context, request FetcherRequest) (FetcherResponse, error)
+}
+
+// sharedTransport is used by every fetcher that doesn't need its own transport
+// configuration, so they share a single connection pool per process.
+var sharedTransport = newSharedTransport()
+
+func newSharedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxResponseHeaderBytes = headerBytesHardLimit(DefaultMaxHeaderBytes)
+	transport.IdleConnTimeout = DefaultIdleConnTimeout
+	return transport
+}
+
+// DefaultIdleConnTimeout is how long an idle connection is kept for reuse
+// unless WithIdleConnTimeout is used.
+const DefaultIdleConnTimeout = 90 * time.Second
+
+// DefaultUserAgent is sent with every request unless WithUserAgent is used.
+const DefaultUserAgent = "wheregoes"
+
+// DefaultAccept is sent as the Accept header of every request unless
+// WithAccept is used.
+const DefaultAccept = "*/*"
+
+type fetcherConfig struct {
+	proxies        []*url.URL
+	perHostRateRps float64
+	timeout        time.Duration
+	userAgent      string
+	accept         string
+	insecureTLS    bool
+	maxHeaderBytes int64
+	maxHeaders     int
+	http1Only      bool
+	noKeepAlives   bool
+	idleTimeout    time.Duration
+	localAddr      net.IP
+	resolvers      []ShortUrlResolver
+}
+
+func (c *fetcherConfig) needsOwnTransport() bool {
+	return len(c.proxies) > 0 || c.insecureTLS || headerBytesHardLimit(c.maxHeaderBytes) != sharedTransport.MaxResponseHeaderBytes || c.http1Only || c.noKeepAlives ||
+		c.idleTimeout != DefaultIdleConnTimeout || c.localAddr != nil
+}
+
+type FetcherOption func(config *fetcherConfig)
+
+// WithProxy routes every request through the given proxy.
+func WithProxy(proxy *url.URL) FetcherOption {
+	return WithProxies([]*url.URL{proxy})
+}
+
+// WithProxies rotates requests through the given proxies in round-robin order.
+// The n-th request made by the client (starting at zero) goes through
+// proxies[n % len(proxies)], so a single track uses the first proxy for its
+// first hop, the second proxy for its second hop and so on. When the client is
+// shared between concurrent tracks the rotation is global to the client, not
+// per track.
+func WithProxies(proxies []*url.URL) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.proxies = append(config.proxies[:0:0], proxies...)
+	}
+}
+
+// WithPerHostRateLimit limits requests to each host to requestsPerSecond,
+// shared by every track using this client, so concurrent tracks don't
+// overwhelm a single origin. Requests wait for their turn.
+func WithPerHostRateLimit(requestsPerSecond float64) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.perHostRateRps = requestsPerSecond
+	}
+}
+
+// WithTimeout bounds each request, from connecting to reading the body. No
+// timeout is set by default, so requests are bound by their context only.
+func WithTimeout(timeout time.Duration) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.timeout = timeout
+	}
+}
+
+// WithUserAgent sends userAgent instead of DefaultUserAgent.
+func WithUserAgent(userAgent string) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.userAgent = userAgent
+	}
+}
+
+// WithAccept sends accept as the Accept header of every request instead of
+// DefaultAccept, e.g. a browser's, since some servers redirect differently
+// depending on it.
+func WithAccept(accept string) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.accept = accept
+	}
+}
+
+// WithInsecureTLS skips verifying TLS certificates, for tracking urls on hosts
+// with self-signed or expired certificates.
+func WithInsecureTLS() FetcherOption {
+	return func(config *fetcherConfig) {
+		config.insecureTLS = true
+	}
+}
+
+// WithMaxHeaderBytes keeps at most maxHeaderBytes of response headers per
+// hop, DefaultMaxHeaderBytes by default, dropping the values past it and
+// setting FetcherResponse.HeadersTruncated, like WithMaxHeaders. Only hops
+// whose headers are several times larger fail.
+func WithMaxHeaderBytes(maxHeaderBytes int64) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.maxHeaderBytes = maxHeaderBytes
+	}
+}
+
+// WithMaxHeaders keeps at most maxHeaders response header values per hop,
+// DefaultMaxHeaders by default, dropping the rest and setting
+// FetcherResponse.HeadersTruncated. Location, Content-Type and Set-Cookie
+// are kept first.
+func WithMaxHeaders(maxHeaders int) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.maxHeaders = maxHeaders
+	}
+}
+
+// WithHTTP1Only disables HTTP/2, so every request is made with HTTP/1.1 even
+// when the server negotiates HTTP/2, to reproduce how legacy clients are
+// answered. Go's client can't make HTTP/1.0 requests.
+func WithHTTP1Only() FetcherOption {
+	return func(config *fetcherConfig) {
+		config.http1Only = true
+	}
+}
+
+// WithoutKeepAlives opens a fresh connection for every request instead of
+// reusing one to the same host, so each hop's latency includes its DNS
+// lookup, TCP connect and TLS handshake. Tracks get slower, but latencies
+// reflect what a first-time visitor sees.
+func WithoutKeepAlives() FetcherOption {
+	return func(config *fetcherConfig) {
+		config.noKeepAlives = true
+	}
+}
+
+// WithIdleConnTimeout closes connections left idle for longer than timeout,
+// DefaultIdleConnTimeout by default, instead of keeping them for reuse. Zero
+// keeps them until the server closes them.
+func WithIdleConnTimeout(timeout time.Duration) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.idleTimeout = timeout
+	}
+}
+
+// WithLocalAddr makes every connection from localAddr, one of the host's own
+// IPs, so tracks egress from the interface it's assigned to on multi-homed
+// hosts. Connections to hosts of the other IP family fail, as do all of them
+// when localAddr isn't assigned to the host.
+func WithLocalAddr(localAddr net.IP) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.localAddr = localAddr
+	}
+}
+
+// WithShortUrlResolvers expands the short urls recognized by resolvers with
+// their shortener's API, answering GET requests to them with a 301 to the
+// expanded url instead of fetching them. Urls no resolver recognizes, or that
+// fail to expand, are fetched as usual.
+func WithShortUrlResolvers(resolvers ...ShortUrlResolver) FetcherOption {
+	return func(config *fetcherConfig) {
+		config.resolvers = append(config.resolvers, resolvers...)
+	}
 }
 
 type defaultHttpFetcherClient struct {
-	client *http.Client
+	transport   *http.Transport
+	timeout     time.Duration
+	rateLimiter *hostRateLimiter
+	userAgent   string
+	accept      string
+	maxHeaders  int
+	// maxHeaderBytes bounds the headers kept, below the transport's
+	// MaxResponseHeaderBytes.
+	maxHeaderBytes int64
+	resolvers      []ShortUrlResolver
+}
+
+// CloseIdleConnections closes the connections of the client's transport that
+// are idle, like http.Client.CloseIdleConnections. Long-running processes can
+// call it periodically, so connections to hosts visited once don't pile up.
+// Fetchers sharing the process-wide transport close each other's too.
+func (f *defaultHttpFetcherClient) CloseIdleConnections() {
+	f.transport.CloseIdleConnections()
 }
 
-func (f *defaultHttpFetcherClient) Fetch(ctx context.Context, url string) (FetcherResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (f *defaultHttpFetcherClient) Fetch(ctx context.Context, request FetcherRequest) (FetcherResponse, error) {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// Like http.Client's Timeout, the timeout covers reading the body, which
+	// is done before returning.
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	if method == http.MethodGet {
+		if expanded, resolver, ok := expandShortUrl(ctx, f.resolvers, request.Url); ok {
+			return FetcherResponse{
+				StatusCode: http.StatusMovedPermanently,
+				Headers:    http.Header{"Location": []string{expanded}},
+				ExpandedBy: resolver.Name(),
+			}, nil
+		}
+	}
+
+	var body io.Reader
+	if request.Body != nil {
+		body = bytes.NewReader(request.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, request.Url, body)
 	if err != nil {
 		return FetcherResponse{}, err
 	}
 
-	req.Header.Add("User-Agent", "wheregoes")
-	req.Header.Add("Accept", "*/*")
-	res, err := f.client.Do(req)
+	if request.ContentType != "" {
+		req.Header.Set("Content-Type", request.ContentType)
+	}
+
+	for name, values := range request.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	if request.Referer != "" {
+		req.Header.Set("Referer", request.Referer)
+	}
+
+	for _, cookie := range request.Cookies {
+		req.AddCookie(cookie)
+	}
+
+	var waited time.Duration
+	if f.rateLimiter != nil {
+		waitStart := time.Now()
+		if err = f.rateLimiter.Wait(ctx, req.URL.Host); err != nil {
+			return FetcherResponse{}, err
+		}
+		waited = time.Since(waitStart)
+	}
+
+	req.Header.Add("User-Agent", f.userAgent)
+	req.Header.Add("Accept", f.accept)
+	res, err := f.roundTrip(req)
 	if err != nil {
 		return FetcherResponse{}, err
 	}
+	defer res.Body.Close()
 
-	return FetcherResponse{
+	response := FetcherResponse{
 		StatusCode: res.StatusCode,
-		Headers:    res.Header,
-	}, nil
+		Proto:      res.Proto,
+		Waited:     waited,
+	}
+	if request.CaptureRequestHeaders {
+		response.RequestHeaders = req.Header.Clone()
+	}
+	response.Headers, response.HeadersTruncated = truncateHeaders(res.Header, f.maxHeaders, f.maxHeaderBytes)
+
+	isRedirect := res.StatusCode >= 300 && res.StatusCode < 400
+	acceptsContentType := len(request.BodyContentTypes) == 0 ||
+		utils.MatchesContentType(res.Header.Get("Content-Type"), request.BodyContentTypes)
+	if request.MaxBodyBytes > 0 && !isRedirect && acceptsContentType {
+		response.Body, response.BodyTimedOut, err = readBody(res.Body, request.MaxBodyBytes, request.BodyReadTimeout)
+		if err != nil {
+			return FetcherResponse{}, err
+		}
+	}
+
+	return response, nil
 }
 
-func NewHttpFetcherClient() FetcherClient {
-	return &defaultHttpFetcherClient{
-		client: &http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		},
+// roundTrip sends req through the transport directly rather than an
+// http.Client: redirects are never followed, and the client fails requests
+// whose Location header doesn't parse before handing back the response, when
+// the tracker would rather pick another Location or stop the chain on it
+// itself. Like the client, it sends the url's credentials as basic auth and
+// wraps errors in a *url.Error.
+func (f *defaultHttpFetcherClient) roundTrip(req *http.Request) (*http.Response, error) {
+	if user := req.URL.User; user != nil && req.Header.Get("Authorization") == "" {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
 	}
+
+	res, err := f.transport.RoundTrip(req)
+	if err != nil {
+		op := req.Method[:1] + strings.ToLower(req.Method[1:])
+		return nil, &url.Error{Op: op, URL: req.URL.Redacted(), Err: err}
+	}
+	return res, nil
+}
+
+// readBody reads up to maxBytes of body. When timeout is positive and passes
+// before the read is done, body is closed to unblock it and whatever was read
+// so far is returned along with timedOut.
+func readBody(body io.ReadCloser, maxBytes int64, timeout time.Duration) (data []byte, timedOut bool, err error) {
+	if timeout <= 0 {
+		data, err = io.ReadAll(io.LimitReader(body, maxBytes))
+		return data, false, err
+	}
+
+	var expired atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		expired.Store(true)
+		body.Close()
+	})
+	data, err = io.ReadAll(io.LimitReader(body, maxBytes))
+	timer.Stop()
+
+	if err != nil && expired.Load() {
+		return data, true, nil
+	}
+	return data, false, err
+}
+
+func roundRobinProxy(proxies []*url.URL) func(*http.Request) (*url.URL, error) {
+	var next uint64
+	return func(*http.Request) (*url.URL, error) {
+		i := atomic.AddUint64(&next, 1) - 1
+		return proxies[i%uint64(len(proxies))], nil
+	}
+}
+
+func newFetcherConfig(opts []FetcherOption) *fetcherConfig {
+	config := &fetcherConfig{
+		userAgent:      DefaultUserAgent,
+		accept:         DefaultAccept,
+		maxHeaderBytes: DefaultMaxHeaderBytes,
+		maxHeaders:     DefaultMaxHeaders,
+		idleTimeout:    DefaultIdleConnTimeout,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// transport returns the shared transport, or one of its own when the config
+// needs it.
+func (c *fetcherConfig) transport() *http.Transport {
+	if !c.needsOwnTransport() {
+		return sharedTransport
+	}
+
+	transport := sharedTransport.Clone()
+	if len(c.proxies) > 0 {
+		transport.Proxy = roundRobinProxy(c.proxies)
+	}
+	if c.insecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transport.MaxResponseHeaderBytes = headerBytesHardLimit(c.maxHeaderBytes)
+	if c.http1Only {
+		// A non-nil empty TLSNextProto turns HTTP/2 off.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	transport.DisableKeepAlives = c.noKeepAlives
+	transport.IdleConnTimeout = c.idleTimeout
+	if c.localAddr != nil {
+		// The same timeouts as http.DefaultTransport's dialer.
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: &net.TCPAddr{IP: c.localAddr},
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return transport
+}
+
+func NewHttpFetcherClient(opts ...FetcherOption) FetcherClient {
+	config := newFetcherConfig(opts)
+
+	fetcher := &defaultHttpFetcherClient{
+		userAgent:      config.userAgent,
+		accept:         config.accept,
+		maxHeaders:     config.maxHeaders,
+		maxHeaderBytes: config.maxHeaderBytes,
+		resolvers:      config.resolvers,
+		transport:      config.transport(),
+		timeout:        config.timeout,
+	}
+
+	if config.perHostRateRps > 0 {
+		fetcher.rateLimiter = newHostRateLimiter(config.perHostRateRps)
+	}
+
+	return fetcher
 }
@@ -0,0 +1,177 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetchAll fetches urls in parallel with fetcher.
+func fetchAll(t *testing.T, fetcher FetcherClient, urls ...string) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		url := url
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetcher.Fetch(context.Background(), FetcherRequest{Url: url}); err != nil {
+				t.Errorf("Fetch(%s) error = %v", url, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPerHostRateLimit(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = map[string][]time.Time{}
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.Host] = append(received[r.Host], time.Now())
+		mu.Unlock()
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	otherServer := httptest.NewServer(handler)
+	defer otherServer.Close()
+
+	fetcher := NewHttpFetcherClient(WithPerHostRateLimit(1))
+	fetchAll(t, fetcher, server.URL+"/a", server.URL+"/b", otherServer.URL+"/c")
+
+	mu.Lock()
+	defer mu.Unlock()
+	sameHost := received[server.Listener.Addr().String()]
+	if len(sameHost) != 2 {
+		t.Fatalf("the server got %d requests, want 2", len(sameHost))
+	}
+	sort.Slice(sameHost, func(i, j int) bool { return sameHost[i].Before(sameHost[j]) })
+	if gap := sameHost[1].Sub(sameHost[0]); gap < 900*time.Millisecond {
+		t.Errorf("requests to the same host were %s apart, want about 1s", gap)
+	}
+
+	otherHost := received[otherServer.Listener.Addr().String()]
+	if len(otherHost) != 1 {
+		t.Fatalf("the other server got %d requests, want 1", len(otherHost))
+	}
+	if otherHost[0].Sub(sameHost[0]) > 500*time.Millisecond {
+		t.Error("the request to another host was held back by the first host's limit")
+	}
+}
+
+func newTestFetcher(t *testing.T, opts ...FetcherOption) *defaultHttpFetcherClient {
+	t.Helper()
+	fetcher, ok := NewHttpFetcherClient(opts...).(*defaultHttpFetcherClient)
+	if !ok {
+		t.Fatal("NewHttpFetcherClient() didn't return a *defaultHttpFetcherClient")
+	}
+	return fetcher
+}
+
+func TestNewHttpFetcherClientDefaults(t *testing.T) {
+	fetcher := newTestFetcher(t)
+
+	if fetcher.transport != sharedTransport {
+		t.Error("a fetcher without options doesn't use the shared transport")
+	}
+	if fetcher.userAgent != DefaultUserAgent || fetcher.accept != DefaultAccept {
+		t.Errorf("User-Agent and Accept = %q and %q, want the defaults", fetcher.userAgent, fetcher.accept)
+	}
+	if fetcher.timeout != 0 || fetcher.rateLimiter != nil || fetcher.maxHeaders != DefaultMaxHeaders {
+		t.Errorf("fetcher = %+v, want no timeout, no rate limit and DefaultMaxHeaders", fetcher)
+	}
+}
+
+func TestFetcherOptionsApply(t *testing.T) {
+	proxy, _ := url.Parse("http://proxy.test:3128")
+	tests := []struct {
+		name  string
+		opt   FetcherOption
+		check func(fetcher *defaultHttpFetcherClient) bool
+	}{
+		{"WithTimeout", WithTimeout(3 * time.Second), func(f *defaultHttpFetcherClient) bool {
+			return f.timeout == 3*time.Second
+		}},
+		{"WithUserAgent", WithUserAgent("test-agent"), func(f *defaultHttpFetcherClient) bool {
+			return f.userAgent == "test-agent"
+		}},
+		{"WithAccept", WithAccept("text/html"), func(f *defaultHttpFetcherClient) bool {
+			return f.accept == "text/html"
+		}},
+		{"WithMaxHeaders", WithMaxHeaders(10), func(f *defaultHttpFetcherClient) bool {
+			return f.maxHeaders == 10
+		}},
+		{"WithPerHostRateLimit", WithPerHostRateLimit(2), func(f *defaultHttpFetcherClient) bool {
+			return f.rateLimiter != nil && f.rateLimiter.interval == 500*time.Millisecond
+		}},
+		{"WithProxy", WithProxy(proxy), func(f *defaultHttpFetcherClient) bool {
+			used, err := f.transport.Proxy(httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+			return err == nil && used == proxy
+		}},
+		{"WithInsecureTLS", WithInsecureTLS(), func(f *defaultHttpFetcherClient) bool {
+			return f.transport.TLSClientConfig != nil && f.transport.TLSClientConfig.InsecureSkipVerify
+		}},
+		{"WithMaxHeaderBytes", WithMaxHeaderBytes(1024), func(f *defaultHttpFetcherClient) bool {
+			return f.maxHeaderBytes == 1024 && f.transport.MaxResponseHeaderBytes == minHeaderBytesHardLimit
+		}},
+		{"WithMaxHeaderBytes over the hard limit", WithMaxHeaderBytes(8 << 20), func(f *defaultHttpFetcherClient) bool {
+			return f.maxHeaderBytes == 8<<20 && f.transport.MaxResponseHeaderBytes == 32<<20
+		}},
+		{"WithHTTP1Only", WithHTTP1Only(), func(f *defaultHttpFetcherClient) bool {
+			return !f.transport.ForceAttemptHTTP2 && f.transport.TLSNextProto != nil && len(f.transport.TLSNextProto) == 0
+		}},
+		{"WithoutKeepAlives", WithoutKeepAlives(), func(f *defaultHttpFetcherClient) bool {
+			return f.transport.DisableKeepAlives
+		}},
+		{"WithIdleConnTimeout", WithIdleConnTimeout(time.Second), func(f *defaultHttpFetcherClient) bool {
+			return f.transport.IdleConnTimeout == time.Second
+		}},
+		{"WithLocalAddr", WithLocalAddr(net.IPv4(127, 0, 0, 1)), func(f *defaultHttpFetcherClient) bool {
+			return f.transport.DialContext != nil
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := newTestFetcher(t, test.opt)
+			if !test.check(fetcher) {
+				t.Errorf("%s wasn't applied", test.name)
+			}
+		})
+	}
+}
+
+func TestFetcherOptionsOwnTransport(t *testing.T) {
+	fetcher := newTestFetcher(t, WithInsecureTLS())
+
+	if fetcher.transport == sharedTransport {
+		t.Fatal("a fetcher with its own transport settings uses the shared transport")
+	}
+	if sharedTransport.TLSClientConfig != nil && sharedTransport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("WithInsecureTLS leaked into the shared transport")
+	}
+}
+
+func TestFetcherSendsConfiguredHeaders(t *testing.T) {
+	var userAgent, accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, accept = r.UserAgent(), r.Header.Get("Accept")
+	}))
+	defer server.Close()
+
+	fetcher := NewHttpFetcherClient(WithUserAgent("test-agent"), WithAccept("text/html"))
+	if _, err := fetcher.Fetch(context.Background(), FetcherRequest{Url: server.URL}); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if userAgent != "test-agent" || accept != "text/html" {
+		t.Errorf("server got User-Agent %q and Accept %q, want test-agent and text/html", userAgent, accept)
+	}
+}
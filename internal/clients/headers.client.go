@@ -0,0 +1,87 @@
+package clients
+
+import (
+	"net/http"
+	"sort"
+)
+
+// DefaultMaxHeaderBytes and DefaultMaxHeaders bound the response headers kept
+// of a hop: generous for real sites, but keeping hostile ones from bloating
+// memory.
+const (
+	DefaultMaxHeaderBytes = 256 << 10
+	DefaultMaxHeaders     = 256
+)
+
+// minHeaderBytesHardLimit is the least the transport reads of a hop's
+// response headers before failing it, so headers over WithMaxHeaderBytes are
+// truncated rather than ending the chain, while a hostile server still can't
+// make it read without end.
+const minHeaderBytesHardLimit = 4 << 20
+
+// headerBytesHardLimit returns the transport's limit on response headers for
+// a maxHeaderBytes budget of kept ones, well above it.
+func headerBytesHardLimit(maxHeaderBytes int64) int64 {
+	if limit := 4 * maxHeaderBytes; limit > minHeaderBytesHardLimit {
+		return limit
+	}
+	return minHeaderBytesHardLimit
+}
+
+// essentialHeaders are kept first when headers are truncated, since following
+// the chain depends on them.
+var essentialHeaders = []string{"Location", "Content-Type", "Set-Cookie"}
+
+// truncateHeaders returns headers with at most maxHeaders values and
+// maxBytes in total, counted like "Name: value\r\n" on the wire, keeping
+// essentialHeaders first and then the others by name, and whether any were
+// dropped. A value too large for the bytes left is dropped, but smaller ones
+// after it may still be kept.
+func truncateHeaders(headers http.Header, maxHeaders int, maxBytes int64) (http.Header, bool) {
+	count, size := 0, int64(0)
+	for name, values := range headers {
+		count += len(values)
+		for _, value := range values {
+			size += headerSize(name, value)
+		}
+	}
+	if count <= maxHeaders && size <= maxBytes {
+		return headers, false
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append(essentialHeaders[:len(essentialHeaders):len(essentialHeaders)], names...)
+
+	truncated := make(http.Header, len(headers))
+	seen := make(map[string]bool, len(names))
+	left, bytesLeft := maxHeaders, maxBytes
+	for _, name := range names {
+		values, ok := headers[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		for _, value := range values {
+			if left == 0 {
+				return truncated, true
+			}
+			if size := headerSize(name, value); size <= bytesLeft {
+				truncated[name] = append(truncated[name], value)
+				left--
+				bytesLeft -= size
+			}
+		}
+	}
+
+	return truncated, true
+}
+
+// headerSize is the size of a header line on the wire.
+func headerSize(name string, value string) int64 {
+	return int64(len(name) + len(": ") + len(value) + len("\r\n"))
+}
@@ -0,0 +1,76 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTruncateHeaders(t *testing.T) {
+	headers := http.Header{
+		"Location": {"/next"},
+		"X-Big":    {strings.Repeat("a", 100)},
+		"X-Small":  {"b", "c"},
+	}
+
+	tests := []struct {
+		name       string
+		maxHeaders int
+		maxBytes   int64
+		want       http.Header
+		truncated  bool
+	}{
+		{"within limits", 10, 1 << 10, headers, false},
+		{"values", 2, 1 << 10, http.Header{"Location": {"/next"}, "X-Big": {strings.Repeat("a", 100)}}, true},
+		// "Location: /next\r\n" is 17 bytes, and "X-Small: b\r\n" 12.
+		{"bytes", 10, 17 + 12, http.Header{"Location": {"/next"}, "X-Small": {"b"}}, true},
+		{"bytes for essential headers only", 10, 17, http.Header{"Location": {"/next"}}, true},
+		{"no bytes", 10, 0, http.Header{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, truncated := truncateHeaders(headers, test.maxHeaders, test.maxBytes)
+			if !reflect.DeepEqual(got, test.want) || truncated != test.truncated {
+				t.Errorf("truncateHeaders() = %v, %t, want %v, %t", got, truncated, test.want, test.truncated)
+			}
+		})
+	}
+}
+
+func TestFetchTruncatesLargeHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 8; i++ {
+			w.Header().Add("X-Padding", strings.Repeat("a", 1<<10))
+		}
+		http.Redirect(w, r, "/next", http.StatusFound)
+	}))
+	defer server.Close()
+
+	fetcher := NewHttpFetcherClient(WithMaxHeaderBytes(4 << 10))
+	response, err := fetcher.Fetch(context.Background(), FetcherRequest{Url: server.URL})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v, want the headers truncated instead", err)
+	}
+
+	if !response.HeadersTruncated {
+		t.Error("HeadersTruncated = false for headers over WithMaxHeaderBytes")
+	}
+	if got := response.Headers.Get("Location"); got != "/next" {
+		t.Errorf("Location = %q, want it kept", got)
+	}
+	size := int64(0)
+	for name, values := range response.Headers {
+		for _, value := range values {
+			size += headerSize(name, value)
+		}
+	}
+	if size > 4<<10 {
+		t.Errorf("kept %d bytes of headers, want at most %d", size, 4<<10)
+	}
+	if kept := len(response.Headers.Values("X-Padding")); kept == 0 || kept == 8 {
+		t.Errorf("kept %d of the 8 padding headers, want some dropped", kept)
+	}
+}
@@ -0,0 +1,34 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+)
+
+// NativeFinalUrl follows the redirects of url with net/http's own redirect
+// policy, up to 10 of them, and returns the url it ends at. It cross-checks a
+// tracker's hop by hop resolution. opts configure the requests like the
+// fetcher's, except for rate limits and short url resolvers, which don't
+// apply.
+func NativeFinalUrl(ctx context.Context, url string, opts ...FetcherOption) (string, error) {
+	config := newFetcherConfig(opts)
+	client := &http.Client{
+		Timeout:   config.timeout,
+		Transport: config.transport(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", config.userAgent)
+	req.Header.Set("Accept", config.accept)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	return res.Request.URL.String(), nil
+}
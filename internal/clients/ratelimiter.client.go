@@ -0,0 +1,60 @@
+package clients
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxTrackedHosts bounds the limiter's memory; hosts whose slot is already in
+// the past are pruned once it's reached.
+const maxTrackedHosts = 1024
+
+// hostRateLimiter spaces requests to the same host at least interval apart,
+// independently for each host.
+type hostRateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostRateLimiter(requestsPerSecond float64) *hostRateLimiter {
+	return &hostRateLimiter{
+		interval: time.Duration(float64(time.Second) / requestsPerSecond),
+		next:     make(map[string]time.Time),
+	}
+}
+
+// Wait blocks until a request to host is allowed or ctx is done.
+func (l *hostRateLimiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	if len(l.next) >= maxTrackedHosts {
+		for h, slot := range l.next {
+			if slot.Before(now) {
+				delete(l.next, h)
+			}
+		}
+	}
+
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
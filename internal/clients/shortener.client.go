@@ -0,0 +1,121 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ShortUrlResolver expands the short urls of a shortener with the
+// shortener's API, instead of following its redirect.
+type ShortUrlResolver interface {
+	// Name identifies the shortener in checkpoint notes, e.g. "bit.ly".
+	Name() string
+	// Matches reports whether shortUrl is one of the shortener's.
+	Matches(shortUrl *url.URL) bool
+	// Expand returns the url shortUrl leads to.
+	Expand(ctx context.Context, shortUrl *url.URL) (string, error)
+}
+
+// bitlyHosts are the domains bit.ly short urls are served from.
+var bitlyHosts = []string{"bit.ly", "j.mp", "bitly.com"}
+
+const bitlyExpandUrl = "https://api-ssl.bitly.com/v4/expand"
+
+type bitlyResolver struct {
+	token  string
+	client *http.Client
+}
+
+// NewBitlyResolver expands bit.ly short urls with the bit.ly API,
+// authenticated with an access token.
+func NewBitlyResolver(token string) ShortUrlResolver {
+	return &bitlyResolver{
+		token:  token,
+		client: &http.Client{Transport: sharedTransport},
+	}
+}
+
+func (r *bitlyResolver) Name() string {
+	return "bit.ly"
+}
+
+func (r *bitlyResolver) Matches(shortUrl *url.URL) bool {
+	host := strings.ToLower(shortUrl.Hostname())
+	for _, bitlyHost := range bitlyHosts {
+		if host == bitlyHost {
+			return strings.Trim(shortUrl.Path, "/") != ""
+		}
+	}
+	return false
+}
+
+func (r *bitlyResolver) Expand(ctx context.Context, shortUrl *url.URL) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"bitlink_id": strings.ToLower(shortUrl.Hostname()) + shortUrl.EscapedPath(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, bitlyExpandUrl, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("bit.ly API answered %d", res.StatusCode)
+	}
+
+	var expanded struct {
+		LongUrl string `json:"long_url"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&expanded); err != nil {
+		return "", err
+	}
+	if expanded.LongUrl == "" {
+		return "", fmt.Errorf("bit.ly API answered without a long url")
+	}
+
+	return expanded.LongUrl, nil
+}
+
+// expandShortUrl expands rawUrl with the first of resolvers matching it. It
+// reports false when none does or the expansion failed, so the url is fetched
+// as usual.
+func expandShortUrl(ctx context.Context, resolvers []ShortUrlResolver, rawUrl string) (string, ShortUrlResolver, bool) {
+	if len(resolvers) == 0 {
+		return "", nil, false
+	}
+
+	shortUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", nil, false
+	}
+
+	for _, resolver := range resolvers {
+		if !resolver.Matches(shortUrl) {
+			continue
+		}
+
+		expanded, err := resolver.Expand(ctx, shortUrl)
+		if err != nil {
+			return "", nil, false
+		}
+		return expanded, resolver, true
+	}
+
+	return "", nil, false
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/pkg/pool"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+func report() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report [url...]",
+		Short: "Track many URLs and report aggregate stats",
+		Long: "Track many URLs and report how their chains end: final statuses, average hops, " +
+			"redirect statuses and the most common intermediate domains.\n" +
+			"URLs are read from stdin, one per line, when none are given or the only one is -.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			top, _ := cmd.Flags().GetInt("top")
+			if top < 0 {
+				return fmt.Errorf("--top must not be negative")
+			}
+
+			var trackerOpts []wheregoes.TrackerOption
+			if compact, err := compactChainOption(cmd); err != nil {
+				return err
+			} else if compact != nil {
+				trackerOpts = append(trackerOpts, compact)
+			}
+
+			urls := args
+			if len(args) == 0 || len(args) == 1 && args[0] == "-" {
+				var err error
+				if urls, err = readUrls(cmd.InOrStdin()); err != nil {
+					return err
+				}
+			}
+			if len(urls) == 0 {
+				return fmt.Errorf("no urls to report on")
+			}
+
+			cmd.SilenceUsage = true
+			service := wheregoes.NewTrackerService(wheregoes.NewHttpFetcherClient(), trackerOpts...)
+			results := trackBatch(cmd.Context(), service, urls, concurrency)
+
+			if err := cmd.Context().Err(); err != nil {
+				return err
+			}
+			if dir, _ := cmd.Flags().GetString("output-dir"); dir != "" {
+				if err := writeBatchOutput(dir, urls, results, cmd.ErrOrStderr()); err != nil {
+					return fmt.Errorf("--output-dir: %w", err)
+				}
+			}
+
+			stats := newBatchReport(results, top)
+			if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+				return json.NewEncoder(cmd.OutOrStdout()).Encode(stats)
+			}
+			return stats.print(cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().Int("concurrency", 4, "Maximum urls tracked at once")
+	cmd.Flags().Bool("json", false, "Print the report in JSON format")
+	cmd.Flags().Int("top", 10, "Number of most common intermediate domains listed")
+	cmd.Flags().String("output-dir", "", "Write each tracked url's chain as JSON to a file in this directory named after the url, created when missing")
+	addCompactChainFlags(cmd)
+
+	return cmd
+}
+
+// trackBatch tracks urls with service, at most concurrency at once, and
+// returns their results in the same order.
+func trackBatch(ctx context.Context, service wheregoes.TrackerService, urls []string, concurrency int) []batchResult {
+	results := make([]batchResult, len(urls))
+	pool.New(concurrency, nil).Run(len(urls), func(i int) {
+		if !utils.IsUrl(urls[i]) {
+			results[i].err = wheregoes.ErrInvalidUrl
+			return
+		}
+		response, err := service.Track(ctx, urls[i])
+		results[i] = batchResult{response: response, err: err}
+	})
+	return results
+}
+
+// writeBatchOutput writes the response of each of results tracked without
+// error as JSON to its file in dir, reporting each file written to log. Like
+// with track, failed tracks get no file.
+func writeBatchOutput(dir string, urls []string, results []batchResult, log io.Writer) error {
+	paths := outputFilePaths(dir, urls, ".json")
+	for i, result := range results {
+		if result.err != nil {
+			continue
+		}
+		file, err := createOutputFile(paths[i])
+		if err != nil {
+			return err
+		}
+		err = json.NewEncoder(file).Encode(result.response)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+			return err
+		}
+		fmt.Fprintf(log, "Wrote %s\n", file.Name())
+	}
+	return nil
+}
+
+// readUrls reads a url per line from r, skipping blank lines and lines
+// starting with #.
+func readUrls(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
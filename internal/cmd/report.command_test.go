@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errFetchFailed = errors.New("fetch failed")
+
+// concurrencyFetcher answers every url with a 200 after a short wait,
+// recording the most fetches it saw at once. Urls containing "fail" fail.
+type concurrencyFetcher struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *concurrencyFetcher) Fetch(ctx context.Context, request wheregoes.FetcherRequest) (wheregoes.FetcherResponse, error) {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if strings.Contains(request.Url, "fail") {
+		return wheregoes.FetcherResponse{}, errFetchFailed
+	}
+	return wheregoes.FetcherResponse{StatusCode: http.StatusOK}, nil
+}
+
+// runTrackBatch runs trackBatch, failing the test if it doesn't return.
+func runTrackBatch(t *testing.T, fetcher wheregoes.FetcherClient, urls []string, concurrency int) []batchResult {
+	t.Helper()
+
+	done := make(chan []batchResult, 1)
+	go func() {
+		done <- trackBatch(context.Background(), wheregoes.NewTrackerService(fetcher), urls, concurrency)
+	}()
+	select {
+	case results := <-done:
+		return results
+	case <-time.After(10 * time.Second):
+		t.Fatal("trackBatch() deadlocked")
+		return nil
+	}
+}
+
+func TestTrackBatchConcurrency(t *testing.T) {
+	urls := make([]string, 100)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/%d", i)
+	}
+
+	fetcher := &concurrencyFetcher{}
+	results := runTrackBatch(t, fetcher, urls, 4)
+
+	if fetcher.maxInFlight > 4 {
+		t.Errorf("up to %d fetches ran at once, want at most 4", fetcher.maxInFlight)
+	}
+	if fetcher.maxInFlight < 2 {
+		t.Errorf("up to %d fetches ran at once, want them concurrent", fetcher.maxInFlight)
+	}
+	for i, result := range results {
+		if result.err != nil || result.response.Url != urls[i] {
+			t.Errorf("results[%d] = %+v, want %s tracked", i, result, urls[i])
+		}
+	}
+}
+
+func TestTrackBatchPartialFailures(t *testing.T) {
+	var urls []string
+	for i := 0; i < 30; i++ {
+		switch i % 3 {
+		case 0:
+			urls = append(urls, fmt.Sprintf("https://example.com/fail/%d", i))
+		case 1:
+			urls = append(urls, "not a url")
+		default:
+			urls = append(urls, fmt.Sprintf("https://example.com/%d", i))
+		}
+	}
+
+	results := runTrackBatch(t, &concurrencyFetcher{}, urls, 2)
+
+	for i, result := range results {
+		var want error
+		switch i % 3 {
+		case 0:
+			want = errFetchFailed
+		case 1:
+			want = wheregoes.ErrInvalidUrl
+		}
+		if !errors.Is(result.err, want) {
+			t.Errorf("results[%d].err = %v, want %v", i, result.err, want)
+		}
+	}
+}
+
+func TestWriteBatchOutput(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	urls := []string{
+		"https://example.com/a?b",
+		"https://example.com/fail",
+		"https://example.com/a?b",
+		"https://example.com/a/b",
+	}
+	results := runTrackBatch(t, &concurrencyFetcher{}, urls, 2)
+
+	var log bytes.Buffer
+	if err := writeBatchOutput(dir, urls, results, &log); err != nil {
+		t.Fatalf("writeBatchOutput() error = %v", err)
+	}
+
+	paths := outputFilePaths(dir, urls, ".json")
+	written := map[string]bool{}
+	for i, path := range paths {
+		if written[path] {
+			t.Fatalf("%s is shared by more than one url: %v", path, paths)
+		}
+		written[path] = true
+
+		content, err := os.ReadFile(path)
+		if i == 1 {
+			if !os.IsNotExist(err) {
+				t.Errorf("the failed track of %s left a file, error = %v", urls[i], err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", path, err)
+		}
+		var response wheregoes.TrackResponse
+		if err := json.Unmarshal(content, &response); err != nil || response.Url != urls[i] {
+			t.Errorf("%s holds %q, want the track of %s", path, content, urls[i])
+		}
+		if !strings.Contains(log.String(), "Wrote "+path) {
+			t.Errorf("%s wasn't reported:\n%s", path, log.String())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// batchResult is the outcome of one url's track in a report.
+type batchResult struct {
+	response wheregoes.TrackResponse
+	err      error
+}
+
+// domainCount is how many chains passed through an intermediate domain.
+type domainCount struct {
+	Domain string `json:"domain"`
+	Chains int    `json:"chains"`
+}
+
+// batchReport aggregates the tracks of many urls, e.g. for SEO reporting.
+type batchReport struct {
+	Urls   int `json:"urls"`
+	Failed int `json:"failed"`
+	// Errors counts the failed tracks by kind, like "network" or "timeout".
+	Errors map[string]int `json:"errors,omitempty"`
+	// FinalStatuses counts the tracked chains by the status of their final
+	// hop.
+	FinalStatuses map[int]int `json:"finalStatuses"`
+	// AverageHops is the average number of hops of the tracked chains.
+	AverageHops float64 `json:"averageHops"`
+	// RedirectStatuses counts the redirect hops of every tracked chain by
+	// status, like 301 or 302.
+	RedirectStatuses map[int]int `json:"redirectStatuses"`
+	// IntermediateDomains lists the domains most chains passed through between
+	// their first and final hops, most common first.
+	IntermediateDomains []domainCount `json:"intermediateDomains"`
+}
+
+// errorKinds names the failed tracks' kinds in reports, by exit code.
+var errorKinds = map[int]string{
+	exitCodeGeneric:          "other",
+	exitCodeInvalidUrl:       "invalid url",
+	exitCodeCircularRedirect: "circular redirect",
+	exitCodeTooManyRedirects: "too many redirects",
+	exitCodeTimeout:          "timeout",
+	exitCodeNetwork:          "network",
+}
+
+// newBatchReport aggregates results, listing the top most common intermediate
+// domains.
+func newBatchReport(results []batchResult, top int) batchReport {
+	report := batchReport{
+		Urls:                len(results),
+		FinalStatuses:       map[int]int{},
+		RedirectStatuses:    map[int]int{},
+		IntermediateDomains: []domainCount{},
+	}
+
+	hops := 0
+	domains := map[string]int{}
+	for _, result := range results {
+		if result.err != nil {
+			if report.Errors == nil {
+				report.Errors = map[string]int{}
+			}
+			report.Failed++
+			report.Errors[errorKinds[ExitCodeOf(result.err)]]++
+			continue
+		}
+
+		checkpoints := result.response.Checkpoints
+		hops += result.response.HopCount()
+		report.FinalStatuses[checkpoints[len(checkpoints)-1].Status]++
+		for _, checkpoint := range checkpoints {
+			if wheregoes.IsRedirectStatus(checkpoint.Status) {
+				report.RedirectStatuses[checkpoint.Status]++
+			}
+		}
+		for _, domain := range intermediateDomains(checkpoints) {
+			domains[domain]++
+		}
+	}
+
+	if tracked := report.Urls - report.Failed; tracked > 0 {
+		report.AverageHops = float64(hops) / float64(tracked)
+	}
+
+	for domain, chains := range domains {
+		report.IntermediateDomains = append(report.IntermediateDomains, domainCount{Domain: domain, Chains: chains})
+	}
+	sort.Slice(report.IntermediateDomains, func(i, j int) bool {
+		a, b := report.IntermediateDomains[i], report.IntermediateDomains[j]
+		if a.Chains != b.Chains {
+			return a.Chains > b.Chains
+		}
+		return a.Domain < b.Domain
+	})
+	if len(report.IntermediateDomains) > top {
+		report.IntermediateDomains = report.IntermediateDomains[:top]
+	}
+
+	return report
+}
+
+// print writes the report as human-readable tables.
+func (r batchReport) print(out io.Writer) error {
+	tracked := r.Urls - r.Failed
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Urls:\t%d (%d tracked, %d failed)\n", r.Urls, tracked, r.Failed)
+	fmt.Fprintf(w, "Average hops:\t%.1f\n", r.AverageHops)
+
+	printCounts(w, "Final status", "Chains", r.FinalStatuses)
+	printCounts(w, "Redirect status", "Hops", r.RedirectStatuses)
+
+	if len(r.IntermediateDomains) > 0 {
+		fmt.Fprintln(w, "\nIntermediate domain\tChains\tShare")
+		for _, domain := range r.IntermediateDomains {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", domain.Domain, domain.Chains, share(domain.Chains, tracked))
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		kinds := make([]string, 0, len(r.Errors))
+		for kind := range r.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+
+		fmt.Fprintln(w, "\nError\tUrls\tShare")
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", kind, r.Errors[kind], share(r.Errors[kind], r.Urls))
+		}
+	}
+
+	return w.Flush()
+}
+
+// printCounts writes a table of counts by status, with each status' share of
+// the total, in status order.
+func printCounts(w io.Writer, label string, unit string, counts map[int]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	statuses := make([]int, 0, len(counts))
+	total := 0
+	for status, count := range counts {
+		statuses = append(statuses, status)
+		total += count
+	}
+	sort.Ints(statuses)
+
+	fmt.Fprintf(w, "\n%s\t%s\tShare\n", label, unit)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", status, counts[status], share(counts[status], total))
+	}
+}
+
+func share(count int, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(count)*100/float64(total))
+}
@@ -2,43 +2,169 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/config"
 	"github.com/labstack/gommon/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var TrackCmd = track()
 var ServeCmd = serve()
+var ReportCmd = report()
 
 var DefaultCommand = TrackCmd
 
 var RootCmd = &cobra.Command{
 	Short: "Wheregoes is a CLI tool to track a URL",
-	Long:  "Wheregoes is a CLI tool to track a URL",
-	Run: func(cmd *cobra.Command, args []string) {
+	Long:  "Wheregoes is a CLI tool to track a URL\n" + exitCodesHelp,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if cmd.Flag("version").Value.String() == "true" {
 			fmt.Printf(
 				color.Green(
 					fmt.Sprintf("Version: %s\n", "1.0.0"),
 				),
 			)
-			return
+			return nil
+		}
+
+		return DefaultCommand.RunE(cmd, args)
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flag("version").Value.String() == "true" {
+			return nil
 		}
 
-		DefaultCommand.Run(cmd, args)
-		return
+		return DefaultCommand.PreRunE(cmd, args)
 	},
-	PreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyConfigFile(cmd)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flag("version").Value.String() == "true" {
+			return nil
+		}
+
+		return DefaultCommand.Args(cmd, args)
 	},
-	Args: DefaultCommand.Args,
 }
 
 func init() {
 	RootCmd.AddCommand(TrackCmd)
 	RootCmd.AddCommand(ServeCmd)
+	RootCmd.AddCommand(ReportCmd)
 
 	RootCmd.Flags().BoolP("version", "v", false, "Print version number")
+	RootCmd.PersistentFlags().String("config", "", fmt.Sprintf("Config file with flag defaults (default ./%s when present)", config.DefaultFileName))
 	DefaultCommand.Flags().VisitAll(func(flag *pflag.Flag) {
 		RootCmd.Flags().AddFlag(flag)
 	})
 }
+
+// envAnnotation marks flags whose default comes from an environment variable,
+// so a set variable takes precedence over the config file.
+const envAnnotation = "env"
+
+func markEnv(cmd *cobra.Command, name string, envVar string) {
+	_ = cmd.Flags().SetAnnotation(name, envAnnotation, []string{envVar})
+}
+
+// envInt reads an integer flag default from envVar, falling back to def when
+// it's unset or malformed.
+func envInt(envVar string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(envVar))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envBool reads a boolean flag default from envVar, falling back to def when
+// it's unset or malformed.
+func envBool(envVar string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(envVar))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envDuration reads a duration flag default from envVar, like "10m",
+// falling back to def when it's unset or malformed.
+func envDuration(envVar string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(envVar))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// envString reads a flag default from envVar, def when it's unset.
+func envString(envVar string, def string) string {
+	if value := os.Getenv(envVar); value != "" {
+		return value
+	}
+	return def
+}
+
+// envList reads a comma separated list flag default from envVar, nil when
+// it's unset.
+func envList(envVar string) []string {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// applyConfigFile sets every flag of cmd that wasn't given on the command line
+// or through its environment variable from the config file, if there's one.
+func applyConfigFile(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("config")
+	if path == "" {
+		if _, err := os.Stat(config.DefaultFileName); err != nil {
+			return nil
+		}
+		path = config.DefaultFileName
+	}
+
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, command := range append(cmd.Root().Commands(), cmd.Root()) {
+		command.Flags().VisitAll(func(flag *pflag.Flag) {
+			known[flag.Name] = true
+		})
+	}
+
+	for key := range file {
+		if !known[key] {
+			log.Printf("Ignoring unknown config key %q in %s", key, path)
+		}
+	}
+
+	var setErr error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		value, ok := file[flag.Name]
+		if !ok || flag.Changed || setErr != nil {
+			return
+		}
+
+		if envVars := flag.Annotations[envAnnotation]; len(envVars) > 0 && os.Getenv(envVars[0]) != "" {
+			return
+		}
+
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			setErr = fmt.Errorf("%s: invalid value for %s: %w", path, flag.Name, err)
+		}
+	})
+
+	return setErr
+}
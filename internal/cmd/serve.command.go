@@ -2,19 +2,23 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/jorgejr568/wheregoes/internal/server"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
 	"github.com/spf13/cobra"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
 func serve() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the server",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithCancel(cmd.Context())
-			signalCh := make(chan os.Signal)
+			signalCh := make(chan os.Signal, 1)
 			go func() {
 				<-signalCh
 				cancel()
@@ -22,13 +26,91 @@ func serve() *cobra.Command {
 
 			signal.Notify(signalCh, os.Interrupt)
 
-			err := server.Serve(ctx)
+			config := server.DefaultConfig()
+			config.Port, _ = cmd.Flags().GetString("port")
+			config.PortFile, _ = cmd.Flags().GetString("port-file")
+			config.BindAddress, _ = cmd.Flags().GetString("bind")
+			config.TLSCertFile, _ = cmd.Flags().GetString("tls-cert")
+			config.TLSKeyFile, _ = cmd.Flags().GetString("tls-key")
+			config.HTTPRedirectPort, _ = cmd.Flags().GetString("http-redirect-port")
+			config.GRPCPort, _ = cmd.Flags().GetString("grpc-port")
+			config.MaxConcurrentTracks, _ = cmd.Flags().GetInt("max-concurrent-tracks")
+			config.BatchConcurrency, _ = cmd.Flags().GetInt("batch-concurrency")
+			config.WSMaxRedirects, _ = cmd.Flags().GetInt("ws-max-redirects")
+			config.AllowedOrigins, _ = cmd.Flags().GetStringSlice("allowed-origins")
+			config.CORSAllowMethods, _ = cmd.Flags().GetStringSlice("cors-allow-methods")
+			config.CORSAllowHeaders, _ = cmd.Flags().GetStringSlice("cors-allow-headers")
+			config.CORSAllowCredentials, _ = cmd.Flags().GetBool("cors-allow-credentials")
+			config.CORSMaxAge, _ = cmd.Flags().GetDuration("cors-max-age")
+			config.RequestIDHeader, _ = cmd.Flags().GetString("request-id-header")
+			config.IdleConnCleanupInterval, _ = cmd.Flags().GetDuration("idle-conn-cleanup-interval")
+			config.IdleConnTimeout, _ = cmd.Flags().GetDuration("idle-conn-timeout")
+			config.ServeUI, _ = cmd.Flags().GetBool("ui")
+			config.ServeMetrics, _ = cmd.Flags().GetBool("metrics")
+			config.TrackLogFile, _ = cmd.Flags().GetString("track-log-file")
+			config.TrackLogMaxSize, _ = cmd.Flags().GetInt64("track-log-max-size")
+			rawPorts, _ := cmd.Flags().GetStringSlice("allowed-ports")
+			allowedPorts, err := parsePorts(rawPorts)
 			if err != nil {
-				panic(err)
+				return fmt.Errorf("--allowed-ports: %w", err)
 			}
+			config.AllowedPorts = allowedPorts
+			if err := config.Validate(); err != nil {
+				return err
+			}
+
+			cmd.SilenceUsage = true
+			err = server.Serve(ctx, config)
+			if errors.Is(err, syscall.EADDRINUSE) {
+				return fmt.Errorf("%v: is another server running? Pick another port with --port", err)
+			}
+			return err
 		},
 	}
 
-	cmd.Flags().StringP("port", "p", "8080", "Port to listen on")
+	cmd.Flags().StringP("port", "p", "8080", "Port to listen on, 0 for one picked by the OS")
+	cmd.Flags().String("port-file", "", "File to write the port listened on to, useful with --port 0")
+	cmd.Flags().String("bind", os.Getenv("BIND_ADDRESS"), "IP address to bind to, all interfaces when empty (env BIND_ADDRESS)")
+	cmd.Flags().String("tls-cert", os.Getenv("TLS_CERT_FILE"), "TLS certificate file, serves HTTPS together with --tls-key (env TLS_CERT_FILE)")
+	cmd.Flags().String("tls-key", os.Getenv("TLS_KEY_FILE"), "TLS private key file (env TLS_KEY_FILE)")
+	cmd.Flags().String("http-redirect-port", os.Getenv("HTTP_REDIRECT_PORT"), "Port for a plain HTTP listener redirecting to HTTPS (env HTTP_REDIRECT_PORT)")
+	cmd.Flags().String("grpc-port", os.Getenv("GRPC_PORT"), "Port for a gRPC listener streaming tracks, off when empty (env GRPC_PORT)")
+	cmd.Flags().Int("max-concurrent-tracks", envInt("MAX_CONCURRENT_TRACKS", 0), "Maximum tracks running at once, unlimited when 0 (env MAX_CONCURRENT_TRACKS)")
+	cmd.Flags().Int("batch-concurrency", envInt("BATCH_CONCURRENCY", server.DefaultBatchConcurrency), "Maximum urls of a single websocket message tracked at once (env BATCH_CONCURRENCY)")
+	cmd.Flags().Int("ws-max-redirects", envInt("WS_MAX_REDIRECTS", server.DefaultWSMaxRedirects), "Maximum redirects a websocket track follows (env WS_MAX_REDIRECTS)")
+	cmd.Flags().StringSlice("allowed-origins", envList("ALLOWED_ORIGINS"), "Browser origins allowed to call the API, * for any (env ALLOWED_ORIGINS, comma separated)")
+	cmd.Flags().StringSlice("cors-allow-methods", envList("CORS_ALLOW_METHODS"), "Methods allowed cross-origin (default GET, POST and OPTIONS) (env CORS_ALLOW_METHODS, comma separated)")
+	cmd.Flags().StringSlice("cors-allow-headers", envList("CORS_ALLOW_HEADERS"), "Request headers allowed cross-origin (default Content-Type, Authorization and the request ID header) (env CORS_ALLOW_HEADERS, comma separated)")
+	cmd.Flags().Bool("cors-allow-credentials", envBool("CORS_ALLOW_CREDENTIALS", false), "Let browsers send cookies and HTTP auth cross-origin, not with the * origin (env CORS_ALLOW_CREDENTIALS)")
+	cmd.Flags().Duration("cors-max-age", envDuration("CORS_MAX_AGE", 0), "How long browsers may cache preflight responses, the browser's default when 0 (env CORS_MAX_AGE)")
+	cmd.Flags().String("request-id-header", envString("REQUEST_ID_HEADER", server.DefaultRequestIDHeader), "Header request IDs are read from and echoed in, e.g. X-Correlation-ID (env REQUEST_ID_HEADER)")
+	cmd.Flags().StringSlice("allowed-ports", envList("ALLOWED_PORTS"), "Ports tracked hops may be fetched from, e.g. 80,443, any when empty (env ALLOWED_PORTS, comma separated)")
+	cmd.Flags().String("track-log-file", os.Getenv("TRACK_LOG_FILE"), "File to append a JSON line per track to, as an audit trail (env TRACK_LOG_FILE)")
+	cmd.Flags().Int64("track-log-max-size", int64(envInt("TRACK_LOG_MAX_SIZE", 0)), "Bytes the track log may grow to before it's rotated to <file>.1, never when 0 (env TRACK_LOG_MAX_SIZE)")
+	cmd.Flags().Duration("idle-conn-cleanup-interval", envDuration("IDLE_CONN_CLEANUP_INTERVAL", server.DefaultIdleConnCleanupInterval), "How often connections to tracked hosts left idle are closed (env IDLE_CONN_CLEANUP_INTERVAL)")
+	cmd.Flags().Duration("idle-conn-timeout", envDuration("IDLE_CONN_TIMEOUT", wheregoes.DefaultIdleConnTimeout), "Close connections to tracked hosts idle for longer than this (env IDLE_CONN_TIMEOUT)")
+	cmd.Flags().Bool("ui", envBool("SERVE_UI", false), "Serve a web page at / tracking urls live over the websocket (env SERVE_UI)")
+	cmd.Flags().Bool("metrics", envBool("SERVE_METRICS", false), "Serve metrics like batch_tracks_in_flight as JSON at /debug/vars (env SERVE_METRICS)")
+	markEnv(cmd, "bind", "BIND_ADDRESS")
+	markEnv(cmd, "tls-cert", "TLS_CERT_FILE")
+	markEnv(cmd, "tls-key", "TLS_KEY_FILE")
+	markEnv(cmd, "http-redirect-port", "HTTP_REDIRECT_PORT")
+	markEnv(cmd, "grpc-port", "GRPC_PORT")
+	markEnv(cmd, "max-concurrent-tracks", "MAX_CONCURRENT_TRACKS")
+	markEnv(cmd, "batch-concurrency", "BATCH_CONCURRENCY")
+	markEnv(cmd, "ws-max-redirects", "WS_MAX_REDIRECTS")
+	markEnv(cmd, "allowed-origins", "ALLOWED_ORIGINS")
+	markEnv(cmd, "cors-allow-methods", "CORS_ALLOW_METHODS")
+	markEnv(cmd, "cors-allow-headers", "CORS_ALLOW_HEADERS")
+	markEnv(cmd, "cors-allow-credentials", "CORS_ALLOW_CREDENTIALS")
+	markEnv(cmd, "cors-max-age", "CORS_MAX_AGE")
+	markEnv(cmd, "request-id-header", "REQUEST_ID_HEADER")
+	markEnv(cmd, "allowed-ports", "ALLOWED_PORTS")
+	markEnv(cmd, "track-log-file", "TRACK_LOG_FILE")
+	markEnv(cmd, "track-log-max-size", "TRACK_LOG_MAX_SIZE")
+	markEnv(cmd, "idle-conn-cleanup-interval", "IDLE_CONN_CLEANUP_INTERVAL")
+	markEnv(cmd, "idle-conn-timeout", "IDLE_CONN_TIMEOUT")
+	markEnv(cmd, "ui", "SERVE_UI")
+	markEnv(cmd, "metrics", "SERVE_METRICS")
 	return cmd
 }
@@ -1,62 +1,815 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/jorgejr568/wheregoes/internal/clients"
-	"github.com/jorgejr568/wheregoes/internal/services"
-	"github.com/labstack/gommon/color"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
 	"github.com/spf13/cobra"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func track() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "track [url]",
 		Short: "Track a URL",
+		Long:  "Track where a URL redirects to, hop by hop.\n" + exitCodesHelp,
 		Args:  cobra.ExactArgs(1),
-		PreRun: func(cmd *cobra.Command, args []string) {
-			urlRegex, err := regexp.Compile(`^https?://`)
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			rawUrl, err := expandUrlFromFlags(cmd, args[0])
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
-			if !urlRegex.MatchString(args[0]) {
-				log.Fatal("Invalid URL")
+			if !utils.IsUrl(rawUrl) {
+				return wheregoes.ErrInvalidUrl
 			}
+
+			if text, _ := cmd.Flags().GetString("template"); text != "" {
+				if _, err := parseHopTemplate(text); err != nil {
+					return err
+				}
+			}
+
+			return nil
 		},
-		Run: func(cmd *cobra.Command, args []string) {
-			service := services.NewTrackerService(
-				clients.NewHttpFetcherClient(),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Past flag validation, errors aren't about usage.
+			cmd.SilenceUsage = true
+
+			quiet, _ := cmd.Flags().GetBool("quiet")
+			if quiet {
+				// Restored once done, for processes running other commands.
+				defer log.SetOutput(log.Writer())
+				log.SetOutput(io.Discard)
+			}
+
+			fetcherOpts, err := fetcherOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			trackerOpts, err := trackerOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			service := wheregoes.NewTrackerService(
+				wheregoes.NewHttpFetcherClient(fetcherOpts...),
+				trackerOpts...,
 			)
 
-			trackerCh := service.TrackChannel(cmd.Context(), args[0])
-			i := 0
-			for {
-				select {
-				case response := <-trackerCh:
-					if response.Err != nil {
-						log.Fatal(response.Err)
+			initialUrl, err := initialUrlFromFlags(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			if interval, _ := cmd.Flags().GetDuration("watch"); interval != 0 {
+				if interval < 0 {
+					return fmt.Errorf("--watch must not be negative")
+				}
+				if cmd.Flags().Changed("output-dir") {
+					return fmt.Errorf("--watch can't be used with --output-dir")
+				}
+				all, _ := cmd.Flags().GetBool("watch-all")
+				return watchTrack(cmd.Context(), service, initialUrl, interval, all, cmd.OutOrStdout())
+			}
+
+			var outputFile *os.File
+			if dir, _ := cmd.Flags().GetString("output-dir"); dir != "" {
+				if outputFile, err = createOutputFile(outputFilePath(dir, initialUrl, outputExtension(cmd))); err != nil {
+					return fmt.Errorf("--output-dir: %w", err)
+				}
+				cmd.SetOut(outputFile)
+				defer func() {
+					outputFile.Close()
+					// Only finished tracks are kept, so the directory never
+					// holds a truncated result.
+					if err != nil {
+						os.Remove(outputFile.Name())
+					} else if !quiet {
+						fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %s\n", outputFile.Name())
 					}
+				}()
+			}
+
+			retries, _ := cmd.Flags().GetInt("retry-chain")
+			if retries < 0 {
+				return fmt.Errorf("--retry-chain must not be negative")
+			}
 
-					if response.Finished {
-						return
+			backoff := retryChainBackoff
+			for attempt := 1; ; attempt++ {
+				// Start the file over, so it only holds the last attempt.
+				if outputFile != nil && attempt > 1 {
+					if err := outputFile.Truncate(0); err != nil {
+						return err
+					}
+					if _, err := outputFile.Seek(0, io.SeekStart); err != nil {
+						return err
 					}
+				}
 
-					checkpoint := response.Checkpoint
+				// A fresh printer per attempt, so counts don't add up across
+				// attempts.
+				printer, err := printerFromFlags(cmd)
+				if err != nil {
+					return err
+				}
 
-					fmt.Print(
-						color.Yellow(
-							fmt.Sprintf("%d ....... %s (%d, %s)\n", i+1, checkpoint.Url, checkpoint.Status, checkpoint.Latency),
-						),
-					)
-					i++
+				response, err := printTrack(cmd.Context(), service, printer, initialUrl)
+				if attempt > retries || ExitCodeOf(err) != exitCodeNetwork {
+					if attempt > 1 && !quiet {
+						fmt.Fprintf(cmd.ErrOrStderr(), "Attempts: %d\n", attempt)
+					}
+					if verify, _ := cmd.Flags().GetBool("verify-native"); verify && err == nil {
+						warnOnNativeMismatch(cmd, initialUrl, response, fetcherOpts)
+					}
+					return err
+				}
+
+				if !quiet {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Attempt %d failed: %v, retrying in %s\n", attempt, err, backoff)
 				}
+				select {
+				case <-time.After(backoff):
+				case <-cmd.Context().Done():
+					return cmd.Context().Err()
+				}
+				backoff *= 2
 			}
 		},
 	}
 
 	cmd.Flags().Bool("json", false, "Print response in JSON format")
+	cmd.Flags().Bool("json-stream", false, "Print each hop as a JSON line as it resolves, then a \"type\":\"summary\" line")
+	cmd.Flags().BoolP("interactive", "i", false, "Render hops live with a spinner, falls back to plain output when not a terminal")
+	cmd.Flags().Bool("summary", false, "Print a compact report: input url, hops, domains passed through and final url")
+	cmd.Flags().Bool("strip-tracking-params", false, "Remove tracking parameters (utm_*, fbclid, gclid...) from the final url of --summary")
+	cmd.Flags().Bool("dot", false, "Print the chain as a Graphviz DOT graph, to render with dot -Tpng")
+	cmd.Flags().Bool("markdown", false, "Print the chain as a Markdown table with a summary line, for issues and docs")
+	cmd.Flags().Bool("as-curl", false, "Print a curl command per hop, with the method, headers and body it was requested with, to reproduce it by hand")
+	cmd.Flags().Bool("count", false, "Print only the number of redirect hops")
+	cmd.Flags().BoolP("quiet", "q", false, "Print only the final url, or the error, with no hops, retry messages or logs")
+	cmd.Flags().String("output-dir", "", "Write the output to a file in this directory named after the url, created when missing, e.g. to archive audits")
+	cmd.Flags().Int("hop", 0, "Print only the url of this hop, or the hop as JSON with --json; negative counts from the end, -1 is the final hop")
+	cmd.Flags().String("template", "", "Go text/template rendered per hop, with .Index, .Url, .Status, .Latency, .Domain and .Protocol")
+	cmd.Flags().Duration("watch", 0, "Track the url again every interval until Ctrl-C, printing a timestamped line with its final url and hop count when either changes")
+	cmd.Flags().Bool("watch-all", false, "Print a line for every --watch run, not only those where something changed")
+	cmd.Flags().Int("retry-chain", 0, "Track again from the start up to this many times when the chain fails with a network error, with backoff")
+	cmd.Flags().StringP("method", "X", http.MethodGet, "HTTP method of the first hop, carried across 307/308 redirects")
+	cmd.Flags().StringP("data", "d", "", "Request body of the first hop, implies POST")
+	cmd.Flags().String("content-type", "", "Content-Type of --data (default application/x-www-form-urlencoded)")
+	cmd.Flags().String("referer", "", "Referer header of the first hop, later hops send the previous hop's url unless --no-referer-chain")
+	cmd.Flags().Bool("no-referer-chain", false, "Keep sending --referer on every hop instead of the previous hop's url")
+	cmd.Flags().String("basic-auth", "", "user:password sent as HTTP Basic auth with the first hop (env BASIC_AUTH)")
+	cmd.Flags().String("auth-forwarding", string(wheregoes.AuthForwardingSameHost), "Redirects --basic-auth is also sent with: same-host, never or always")
+	cmd.Flags().StringArray("inject-hop", nil, "Known hop [status:]url recorded, unfetched, before the url, e.g. 301:https://bit.ly/x; repeatable, status 301 by default")
+	addCompactChainFlags(cmd)
+	cmd.Flags().StringArray("param", nil, "Query parameter key=value added to the initial URL, repeatable")
+	cmd.Flags().Bool("expand-env", false, "Expand $VAR and ${VAR} environment variable references in the URL")
+	cmd.Flags().Bool("normalize-trailing-slash", false, "Treat URLs differing only by a trailing slash as the same hop when detecting loops")
+	cmd.Flags().String("follow-only", "all", "Redirect types to follow: permanent, temporary or all")
+	cmd.Flags().Duration("slow-threshold", 0, "Highlight hops slower than this duration, off by default")
+	cmd.Flags().Duration("hop-budget", 0, "Flag hops slower than this duration, like --slow-threshold unless it's given, to audit links against a latency SLO")
+	cmd.Flags().Bool("strict", false, "Fail the chain at the first hop over --hop-budget")
+	cmd.Flags().Duration("total-latency-budget", 0, "Fail the chain once its hops' latencies add up to more than this, waits between hops excluded")
+	cmd.Flags().String("if-modified-since", "", "If-Modified-Since header sent with the first hop, a 304 answer ends the chain")
+	cmd.Flags().String("if-none-match", "", "If-None-Match header sent with the first hop, a 304 answer ends the chain")
+	cmd.Flags().Duration("hop-delay", 0, "Wait this long before fetching each hop after the first")
+	cmd.Flags().Int("max-redirects", 0, "Fail chains following more redirects than this, unlimited when 0")
+	cmd.Flags().Duration("max-duration", 0, "Fail tracks taking longer than this, --default-timeout applies when 0")
+	cmd.Flags().Duration("default-timeout", wheregoes.DefaultTimeout, "Fail tracks taking longer than this when --max-duration isn't set, unlimited when 0")
+	cmd.Flags().Bool("follow-meta-refresh", false, "Follow <meta http-equiv=\"refresh\"> redirects in HTML pages")
+	cmd.Flags().IntSlice("meta-refresh-statuses", wheregoes.DefaultMetaRefreshStatuses, "Statuses of the pages whose meta refreshes --follow-meta-refresh follows, e.g. 200,404,410")
+	cmd.Flags().String("stop-at", "", "Stop before fetching a url matching this regular expression")
+	cmd.Flags().Bool("same-domain-only", false, "Stop before fetching the first url outside the initial url's registrable domain")
+	cmd.Flags().Bool("cookie-gate", false, "Keep cookies across hops and retry a redirect to the same url once when it sets a cookie")
+	cmd.Flags().Int("max-domains", 0, "Fail chains visiting more distinct registrable domains than this, unlimited when 0")
+	cmd.Flags().StringSlice("allowed-schemes", wheregoes.DefaultAllowedSchemes, "Schemes redirects are followed into, others end the chain unfetched")
+	cmd.Flags().StringSlice("allowed-ports", nil, "Ports hops may be fetched from, e.g. 80,443, others end the chain unfetched (default any)")
+	cmd.Flags().Bool("title", false, "Fetch and print the <title> of the final page")
+	cmd.Flags().StringSlice("html-content-types", utils.DefaultHTMLContentTypes, "Content types whose bodies are parsed as HTML by body-based features")
+	cmd.Flags().Bool("seo", false, "Report the final page's canonical link and og:url")
+	cmd.Flags().Bool("capture-headers", false, "Report each hop's response headers, keyed by lowercased name, in --json, --json-stream and --template output")
+	cmd.Flags().Bool("capture-error-body", false, "Report the start of the final page's body when it's a 4xx or 5xx")
+	cmd.Flags().Int("error-body-bytes", 512, "Maximum bytes of the error body reported by --capture-error-body")
+	cmd.Flags().Int64("max-body-bytes", wheregoes.DefaultMaxBodyBytes, "Maximum bytes of a response body read by body-based features")
+	cmd.Flags().Duration("body-read-timeout", wheregoes.DefaultBodyReadTimeout, "Maximum time spent reading a response body for body-based features, 0 to disable")
+	cmd.Flags().String("proxy", "", "Proxy URL to route every hop through")
+	cmd.Flags().StringSlice("proxies", nil, "Comma-separated proxy URLs, rotated round-robin per hop in the given order")
+	cmd.Flags().Float64("per-host-rps", 0, "Maximum requests per second to a single host, unlimited when 0")
+	cmd.Flags().Duration("timeout", 0, "Timeout for each hop's request, none when 0")
+	cmd.Flags().String("user-agent", wheregoes.DefaultUserAgent, "User-Agent sent with every hop")
+	cmd.Flags().String("accept", wheregoes.DefaultAccept, "Accept header sent with every hop, e.g. a browser's text/html,application/xhtml+xml,*/*;q=0.8")
+	cmd.Flags().Int64("max-header-bytes", wheregoes.DefaultMaxHeaderBytes, "Keep at most this many bytes of response headers per hop, dropping the rest")
+	cmd.Flags().Int("max-headers", wheregoes.DefaultMaxHeaders, "Keep at most this many response header values per hop")
+	cmd.Flags().BoolP("insecure", "k", false, "Don't verify TLS certificates")
+	cmd.Flags().String("bitly-token", "", "Expand bit.ly urls with the bit.ly API using this access token instead of fetching them (env BITLY_TOKEN)")
+	cmd.Flags().String("http-version", "auto", "HTTP version of every hop: auto negotiates HTTP/2 when offered, 1.1 never does")
+	cmd.Flags().Bool("verify-native", false, "Resolve the url again with Go's net/http redirect policy and warn when it ends elsewhere than the chain")
+	cmd.Flags().String("local-addr", "", "Local IP every hop is requested from, to egress from a given interface of a multi-homed host")
+	cmd.Flags().Bool("no-keepalive", false, "Open a fresh connection for every hop, slower but latencies include DNS, connect and TLS like a first visit")
+	markEnv(cmd, "bitly-token", "BITLY_TOKEN")
+	markEnv(cmd, "basic-auth", "BASIC_AUTH")
 
 	return cmd
 }
+
+// retryChainBackoff is the wait before the first --retry-chain attempt, doubled
+// for every following one.
+const retryChainBackoff = time.Second
+
+// printTrack tracks initialUrl, handing the hops to printer as they resolve,
+// and returns the finished track, or the partial one along with a partial
+// chain error.
+func printTrack(ctx context.Context, service wheregoes.TrackerService, printer trackPrinter, initialUrl string) (*wheregoes.TrackResponse, error) {
+	trackerCh := service.TrackChannel(ctx, initialUrl)
+	i := 0
+	for {
+		response, ok := <-trackerCh
+		if !ok || response.Err != nil {
+			if stopper, ok := printer.(interface{ Stop() }); ok {
+				stopper.Stop()
+			}
+
+			if !ok {
+				// The channel closes without a last message when the
+				// context is cancelled, e.g. on Ctrl-C.
+				return nil, ctx.Err()
+			}
+			if response.Response != nil {
+				// The chain up to a hop over a latency budget is printed like
+				// a finished one, its StopReason telling why it ended.
+				if err := printer.Finish(response); err != nil {
+					return nil, err
+				}
+				return response.Response, response.Err
+			}
+			return nil, response.Err
+		}
+
+		if response.Finished {
+			return response.Response, printer.Finish(response)
+		}
+
+		if err := printer.PrintCheckpoint(i+1, response.Checkpoint); err != nil {
+			return nil, err
+		}
+		i++
+	}
+}
+
+// warnOnNativeMismatch resolves initialUrl again with net/http's own redirect
+// policy and warns when it ends somewhere else than response, which may point
+// at a bug in the hop by hop resolution. Options stopping the chain early, like
+// --stop-at, or following more than HTTP redirects, like --follow-meta-refresh,
+// also explain a mismatch.
+func warnOnNativeMismatch(cmd *cobra.Command, initialUrl string, response *wheregoes.TrackResponse, fetcherOpts []wheregoes.FetcherOption) {
+	nativeUrl, err := wheregoes.NativeFinalUrl(cmd.Context(), initialUrl, fetcherOpts...)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: net/http couldn't resolve the url to compare: %v\n", err)
+		return
+	}
+
+	if utils.NormalizeUrl(nativeUrl, false) != utils.NormalizeUrl(response.Url, false) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: net/http's redirect policy ends at %s, the chain ended at %s\n", nativeUrl, response.Url)
+	}
+}
+
+func initialUrlFromFlags(cmd *cobra.Command, rawUrl string) (string, error) {
+	rawUrl, err := expandUrlFromFlags(cmd, rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	rawParams, _ := cmd.Flags().GetStringArray("param")
+	params := url.Values{}
+	for _, rawParam := range rawParams {
+		key, value, ok := strings.Cut(rawParam, "=")
+		if !ok || key == "" {
+			return "", fmt.Errorf("invalid --param %q: expected key=value", rawParam)
+		}
+		params.Add(key, value)
+	}
+
+	return utils.AddQueryParams(rawUrl, params)
+}
+
+// expandUrlFromFlags expands the environment variables referenced by rawUrl
+// when --expand-env is set. Referencing an unset variable is an error rather
+// than an empty string, which would silently track another url.
+func expandUrlFromFlags(cmd *cobra.Command, rawUrl string) (string, error) {
+	if expand, _ := cmd.Flags().GetBool("expand-env"); !expand {
+		return rawUrl, nil
+	}
+
+	var undefined []string
+	expanded := os.Expand(rawUrl, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("--expand-env: undefined environment variable %s in url", strings.Join(undefined, ", "))
+	}
+	return expanded, nil
+}
+
+func printerFromFlags(cmd *cobra.Command) (trackPrinter, error) {
+	out := cmd.OutOrStdout()
+
+	if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+		return &finalUrlTrackPrinter{out: out}, nil
+	}
+
+	if cmd.Flags().Changed("hop") {
+		index, _ := cmd.Flags().GetInt("hop")
+		if index == 0 {
+			return nil, fmt.Errorf("--hop must not be 0, hops are numbered from 1 or from -1 for the last")
+		}
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		return &hopTrackPrinter{out: out, index: index, json: jsonOutput}, nil
+	}
+
+	if count, _ := cmd.Flags().GetBool("count"); count {
+		return &countTrackPrinter{out: out}, nil
+	}
+
+	if stream, _ := cmd.Flags().GetBool("json-stream"); stream {
+		return &ndjsonTrackPrinter{encoder: json.NewEncoder(out)}, nil
+	}
+
+	if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+		return &jsonTrackPrinter{out: out}, nil
+	}
+
+	if summary, _ := cmd.Flags().GetBool("summary"); summary {
+		strip, _ := cmd.Flags().GetBool("strip-tracking-params")
+		return &summaryTrackPrinter{out: out, stripTrackingParams: strip}, nil
+	}
+
+	if dot, _ := cmd.Flags().GetBool("dot"); dot {
+		return &dotTrackPrinter{out: out}, nil
+	}
+
+	if markdown, _ := cmd.Flags().GetBool("markdown"); markdown {
+		return &markdownTrackPrinter{out: out}, nil
+	}
+
+	if asCurl, _ := cmd.Flags().GetBool("as-curl"); asCurl {
+		return &curlTrackPrinter{out: out}, nil
+	}
+
+	text, _ := cmd.Flags().GetString("template")
+	if text != "" {
+		tmpl, err := parseHopTemplate(text)
+		if err != nil {
+			return nil, err
+		}
+		return &templateTrackPrinter{out: out, template: tmpl}, nil
+	}
+
+	if interactive, _ := cmd.Flags().GetBool("interactive"); interactive && isTerminal(out) {
+		return newInteractiveTrackPrinter(out), nil
+	}
+
+	return newDefaultTrackPrinter(out), nil
+}
+
+func trackerOptionsFromFlags(cmd *cobra.Command) ([]wheregoes.TrackerOption, error) {
+	var opts []wheregoes.TrackerOption
+
+	if normalize, _ := cmd.Flags().GetBool("normalize-trailing-slash"); normalize {
+		opts = append(opts, wheregoes.WithTrailingSlashNormalization())
+	}
+
+	maxBodyBytes, _ := cmd.Flags().GetInt64("max-body-bytes")
+	if maxBodyBytes <= 0 {
+		return nil, fmt.Errorf("--max-body-bytes must be positive")
+	}
+	opts = append(opts, wheregoes.WithMaxBodyBytes(maxBodyBytes))
+
+	bodyReadTimeout, _ := cmd.Flags().GetDuration("body-read-timeout")
+	if bodyReadTimeout < 0 {
+		return nil, fmt.Errorf("--body-read-timeout must not be negative")
+	}
+	opts = append(opts, wheregoes.WithBodyReadTimeout(bodyReadTimeout))
+
+	htmlContentTypes, _ := cmd.Flags().GetStringSlice("html-content-types")
+	opts = append(opts, wheregoes.WithHTMLContentTypes(htmlContentTypes))
+
+	if title, _ := cmd.Flags().GetBool("title"); title {
+		opts = append(opts, wheregoes.WithFinalTitle())
+	}
+
+	if seo, _ := cmd.Flags().GetBool("seo"); seo {
+		opts = append(opts, wheregoes.WithSEO())
+	}
+
+	if capture, _ := cmd.Flags().GetBool("capture-headers"); capture {
+		opts = append(opts, wheregoes.WithHeaderCapture())
+	}
+
+	if capture, _ := cmd.Flags().GetBool("capture-error-body"); capture {
+		errorBodyBytes, _ := cmd.Flags().GetInt("error-body-bytes")
+		if errorBodyBytes <= 0 {
+			return nil, fmt.Errorf("--error-body-bytes must be positive")
+		}
+		opts = append(opts, wheregoes.WithErrorBodyCapture(errorBodyBytes))
+	}
+
+	method, _ := cmd.Flags().GetString("method")
+	data, _ := cmd.Flags().GetString("data")
+	contentType, _ := cmd.Flags().GetString("content-type")
+	if cmd.Flags().Changed("data") && !cmd.Flags().Changed("method") {
+		method = http.MethodPost
+	}
+	if data != "" && contentType == "" {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	if method != http.MethodGet || data != "" {
+		opts = append(opts, wheregoes.WithInitialRequest(strings.ToUpper(method), []byte(data), contentType))
+	}
+
+	if slowThreshold, _ := cmd.Flags().GetDuration("slow-threshold"); slowThreshold > 0 {
+		opts = append(opts, wheregoes.WithSlowThreshold(slowThreshold))
+	}
+
+	hopBudget, _ := cmd.Flags().GetDuration("hop-budget")
+	strict, _ := cmd.Flags().GetBool("strict")
+	if hopBudget < 0 {
+		return nil, fmt.Errorf("--hop-budget must not be negative")
+	}
+	if strict && hopBudget == 0 {
+		return nil, fmt.Errorf("--strict requires --hop-budget")
+	}
+	if hopBudget > 0 {
+		// An explicit --slow-threshold still decides which hops are
+		// highlighted.
+		if !cmd.Flags().Changed("slow-threshold") {
+			opts = append(opts, wheregoes.WithSlowThreshold(hopBudget))
+		}
+		if strict {
+			opts = append(opts, wheregoes.WithHopBudget(hopBudget))
+		}
+	}
+
+	totalLatencyBudget, _ := cmd.Flags().GetDuration("total-latency-budget")
+	if totalLatencyBudget < 0 {
+		return nil, fmt.Errorf("--total-latency-budget must not be negative")
+	}
+	if totalLatencyBudget > 0 {
+		opts = append(opts, wheregoes.WithTotalLatencyBudget(totalLatencyBudget))
+	}
+
+	headers := http.Header{}
+	if ifModifiedSince, _ := cmd.Flags().GetString("if-modified-since"); ifModifiedSince != "" {
+		headers.Set("If-Modified-Since", ifModifiedSince)
+	}
+	if ifNoneMatch, _ := cmd.Flags().GetString("if-none-match"); ifNoneMatch != "" {
+		headers.Set("If-None-Match", ifNoneMatch)
+	}
+	if len(headers) > 0 {
+		opts = append(opts, wheregoes.WithInitialHeaders(headers))
+	}
+
+	hopDelay, _ := cmd.Flags().GetDuration("hop-delay")
+	if hopDelay < 0 {
+		return nil, fmt.Errorf("--hop-delay must not be negative")
+	}
+	if hopDelay > 0 {
+		opts = append(opts, wheregoes.WithHopDelay(hopDelay))
+	}
+
+	maxRedirects, _ := cmd.Flags().GetInt("max-redirects")
+	if maxRedirects < 0 {
+		return nil, fmt.Errorf("--max-redirects must not be negative")
+	}
+	if maxRedirects > 0 {
+		opts = append(opts, wheregoes.WithMaxRedirects(maxRedirects))
+	}
+
+	maxDuration, _ := cmd.Flags().GetDuration("max-duration")
+	if maxDuration < 0 {
+		return nil, fmt.Errorf("--max-duration must not be negative")
+	}
+	if maxDuration > 0 {
+		opts = append(opts, wheregoes.WithMaxDuration(maxDuration))
+	}
+
+	defaultTimeout, _ := cmd.Flags().GetDuration("default-timeout")
+	if defaultTimeout < 0 {
+		return nil, fmt.Errorf("--default-timeout must not be negative")
+	}
+	opts = append(opts, wheregoes.WithDefaultTimeout(defaultTimeout))
+
+	if metaRefresh, _ := cmd.Flags().GetBool("follow-meta-refresh"); metaRefresh {
+		opts = append(opts, wheregoes.WithFollowMetaRefresh())
+		statuses, _ := cmd.Flags().GetIntSlice("meta-refresh-statuses")
+		for _, status := range statuses {
+			if status < 100 || status > 599 {
+				return nil, fmt.Errorf("invalid --meta-refresh-statuses status %d", status)
+			}
+		}
+		opts = append(opts, wheregoes.WithMetaRefreshStatuses(statuses))
+	}
+
+	if stopAt, _ := cmd.Flags().GetString("stop-at"); stopAt != "" {
+		stopAtRegex, err := regexp.Compile(stopAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --stop-at: %w", err)
+		}
+		opts = append(opts, wheregoes.WithStopAt(stopAtRegex.MatchString))
+	}
+
+	if referer, _ := cmd.Flags().GetString("referer"); referer != "" {
+		opts = append(opts, wheregoes.WithReferer(referer))
+		if noChain, _ := cmd.Flags().GetBool("no-referer-chain"); !noChain {
+			opts = append(opts, wheregoes.WithRefererChain())
+		}
+	}
+
+	rawHops, _ := cmd.Flags().GetStringArray("inject-hop")
+	for _, rawHop := range rawHops {
+		url, status, err := parseInjectedHop(rawHop)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, wheregoes.WithInjectedHop(url, status))
+	}
+
+	if compact, err := compactChainOption(cmd); err != nil {
+		return nil, err
+	} else if compact != nil {
+		opts = append(opts, compact)
+	}
+
+	if asCurl, _ := cmd.Flags().GetBool("as-curl"); asCurl {
+		opts = append(opts, wheregoes.WithRequestCapture())
+	}
+
+	// Like the bit.ly token, credentials are read from the environment here
+	// so --help doesn't print them.
+	basicAuth, _ := cmd.Flags().GetString("basic-auth")
+	if basicAuth == "" {
+		basicAuth = os.Getenv("BASIC_AUTH")
+	}
+	if basicAuth != "" {
+		username, password, ok := strings.Cut(basicAuth, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --basic-auth: expected user:password")
+		}
+
+		rawForwarding, _ := cmd.Flags().GetString("auth-forwarding")
+		forwarding, err := wheregoes.ParseAuthForwarding(rawForwarding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, wheregoes.WithBasicAuth(username, password, forwarding))
+	}
+
+	if sameDomainOnly, _ := cmd.Flags().GetBool("same-domain-only"); sameDomainOnly {
+		opts = append(opts, wheregoes.WithSameDomainOnly())
+	}
+
+	if cookieGate, _ := cmd.Flags().GetBool("cookie-gate"); cookieGate {
+		opts = append(opts, wheregoes.WithCookieGate())
+	}
+
+	maxDomains, _ := cmd.Flags().GetInt("max-domains")
+	if maxDomains < 0 {
+		return nil, fmt.Errorf("--max-domains must not be negative")
+	}
+	if maxDomains > 0 {
+		opts = append(opts, wheregoes.WithMaxDomains(maxDomains))
+	}
+
+	allowedSchemes, _ := cmd.Flags().GetStringSlice("allowed-schemes")
+	if len(allowedSchemes) == 0 {
+		return nil, fmt.Errorf("--allowed-schemes must not be empty")
+	}
+	opts = append(opts, wheregoes.WithAllowedSchemes(allowedSchemes))
+
+	rawPorts, _ := cmd.Flags().GetStringSlice("allowed-ports")
+	allowedPorts, err := parsePorts(rawPorts)
+	if err != nil {
+		return nil, fmt.Errorf("--allowed-ports: %w", err)
+	}
+	if len(allowedPorts) > 0 {
+		opts = append(opts, wheregoes.WithAllowedPorts(allowedPorts))
+	}
+
+	followOnly, _ := cmd.Flags().GetString("follow-only")
+	redirectType, err := wheregoes.ParseRedirectType(followOnly)
+	if err != nil {
+		return nil, err
+	}
+	if redirectType != "" {
+		opts = append(opts, wheregoes.WithFollowOnly(redirectType))
+	}
+
+	return opts, nil
+}
+
+func fetcherOptionsFromFlags(cmd *cobra.Command) ([]wheregoes.FetcherOption, error) {
+	var opts []wheregoes.FetcherOption
+
+	proxy, _ := cmd.Flags().GetString("proxy")
+	proxies, _ := cmd.Flags().GetStringSlice("proxies")
+	if proxy != "" && len(proxies) > 0 {
+		return nil, fmt.Errorf("--proxy and --proxies are mutually exclusive")
+	}
+
+	if proxy != "" {
+		proxies = []string{proxy}
+	}
+
+	if len(proxies) > 0 {
+		proxyUrls := make([]*url.URL, 0, len(proxies))
+		for _, rawProxy := range proxies {
+			proxyUrl, err := parseProxyUrl(rawProxy)
+			if err != nil {
+				return nil, err
+			}
+			proxyUrls = append(proxyUrls, proxyUrl)
+		}
+		opts = append(opts, wheregoes.WithProxies(proxyUrls))
+	}
+
+	rps, _ := cmd.Flags().GetFloat64("per-host-rps")
+	if rps < 0 {
+		return nil, fmt.Errorf("--per-host-rps must not be negative")
+	}
+	if rps > 0 {
+		opts = append(opts, wheregoes.WithPerHostRateLimit(rps))
+	}
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout < 0 {
+		return nil, fmt.Errorf("--timeout must not be negative")
+	}
+	if timeout > 0 {
+		opts = append(opts, wheregoes.WithTimeout(timeout))
+	}
+
+	if userAgent, _ := cmd.Flags().GetString("user-agent"); userAgent != "" {
+		opts = append(opts, wheregoes.WithUserAgent(userAgent))
+	}
+
+	if accept, _ := cmd.Flags().GetString("accept"); accept != "" {
+		opts = append(opts, wheregoes.WithAccept(accept))
+	}
+
+	maxHeaderBytes, _ := cmd.Flags().GetInt64("max-header-bytes")
+	maxHeaders, _ := cmd.Flags().GetInt("max-headers")
+	if maxHeaderBytes <= 0 || maxHeaders <= 0 {
+		return nil, fmt.Errorf("--max-header-bytes and --max-headers must be positive")
+	}
+	opts = append(opts, wheregoes.WithMaxHeaderBytes(maxHeaderBytes), wheregoes.WithMaxHeaders(maxHeaders))
+
+	if insecure, _ := cmd.Flags().GetBool("insecure"); insecure {
+		opts = append(opts, wheregoes.WithInsecureTLS())
+	}
+
+	// The token is read from the environment here rather than as the flag
+	// default, so --help doesn't print it.
+	bitlyToken, _ := cmd.Flags().GetString("bitly-token")
+	if bitlyToken == "" {
+		bitlyToken = os.Getenv("BITLY_TOKEN")
+	}
+	if bitlyToken != "" {
+		opts = append(opts, wheregoes.WithShortUrlResolvers(wheregoes.NewBitlyResolver(bitlyToken)))
+	}
+
+	if noKeepAlive, _ := cmd.Flags().GetBool("no-keepalive"); noKeepAlive {
+		opts = append(opts, wheregoes.WithoutKeepAlives())
+	}
+
+	if rawLocalAddr, _ := cmd.Flags().GetString("local-addr"); rawLocalAddr != "" {
+		localAddr, err := parseLocalAddr(rawLocalAddr)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, wheregoes.WithLocalAddr(localAddr))
+	}
+
+	switch httpVersion, _ := cmd.Flags().GetString("http-version"); httpVersion {
+	case "auto":
+	case "1.1":
+		opts = append(opts, wheregoes.WithHTTP1Only())
+	case "1.0":
+		return nil, fmt.Errorf("--http-version 1.0 isn't supported, requests are always made with HTTP/1.1 or later")
+	default:
+		return nil, fmt.Errorf("invalid --http-version %q: expected auto or 1.1", httpVersion)
+	}
+
+	return opts, nil
+}
+
+func parseProxyUrl(rawProxy string) (*url.URL, error) {
+	proxyUrl, err := url.Parse(rawProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", rawProxy, err)
+	}
+
+	if proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: expected scheme://host[:port]", rawProxy)
+	}
+
+	return proxyUrl, nil
+}
+
+// parseLocalAddr parses the IP of --local-addr and checks it can be bound, so
+// an IP not assigned to any of the host's interfaces fails up front rather
+// than on every hop.
+func parseLocalAddr(rawLocalAddr string) (net.IP, error) {
+	localAddr := net.ParseIP(rawLocalAddr)
+	if localAddr == nil {
+		return nil, fmt.Errorf("invalid --local-addr %q: expected an IP address", rawLocalAddr)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(localAddr.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("--local-addr %s can't be bound: %w", rawLocalAddr, err)
+	}
+	listener.Close()
+	return localAddr, nil
+}
+
+// parsePorts parses a list of TCP ports, skipping empty entries so a trailing
+// comma is harmless.
+func parsePorts(rawPorts []string) ([]int, error) {
+	var ports []int
+	for _, rawPort := range rawPorts {
+		rawPort = strings.TrimSpace(rawPort)
+		if rawPort == "" {
+			continue
+		}
+
+		port, err := strconv.Atoi(rawPort)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", rawPort)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// defaultInjectedHopStatus is the status of --inject-hop hops given without
+// one, the usual answer of shorteners.
+const defaultInjectedHopStatus = http.StatusMovedPermanently
+
+// parseInjectedHop parses an --inject-hop value, a url optionally preceded by
+// the redirect status it answered with, like 302:https://bit.ly/x.
+func parseInjectedHop(rawHop string) (string, int, error) {
+	url, status := rawHop, defaultInjectedHopStatus
+	if rawStatus, rest, ok := strings.Cut(rawHop, ":"); ok {
+		if parsed, err := strconv.Atoi(rawStatus); err == nil {
+			url, status = rest, parsed
+		}
+	}
+
+	if !utils.IsUrl(url) {
+		return "", 0, fmt.Errorf("invalid --inject-hop %q: expected [status:]url with an http or https url", rawHop)
+	}
+	if !wheregoes.IsRedirectStatus(status) {
+		return "", 0, fmt.Errorf("invalid --inject-hop %q: %d isn't a redirect status", rawHop, status)
+	}
+	return url, status, nil
+}
+
+// addCompactChainFlags adds the flags read by compactChainOption to cmd.
+func addCompactChainFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("compact-chain", false, "Keep only the first --compact-first and last --compact-last hops of long chains, counting the ones between, to bound memory")
+	cmd.Flags().Int("compact-first", 10, "Hops kept at the start of chains compacted by --compact-chain")
+	cmd.Flags().Int("compact-last", 10, "Hops kept at the end of chains compacted by --compact-chain")
+}
+
+// compactChainOption returns the tracker option of cmd's --compact-chain
+// flags, nil when it isn't set.
+func compactChainOption(cmd *cobra.Command) (wheregoes.TrackerOption, error) {
+	if compact, _ := cmd.Flags().GetBool("compact-chain"); !compact {
+		return nil, nil
+	}
+
+	keepFirst, _ := cmd.Flags().GetInt("compact-first")
+	keepLast, _ := cmd.Flags().GetInt("compact-last")
+	if keepFirst < 1 || keepLast < 1 {
+		return nil, fmt.Errorf("--compact-first and --compact-last must be at least 1")
+	}
+	return wheregoes.WithCompactChain(keepFirst, keepLast), nil
+}
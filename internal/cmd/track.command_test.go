@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// executeTrack runs a fresh track command with args, returning its output and
+// error instead of exiting.
+func executeTrack(args ...string) (string, error) {
+	cmd := track()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestTrackCommandInvalidUrl(t *testing.T) {
+	_, err := executeTrack("not a url")
+	if !errors.Is(err, wheregoes.ErrInvalidUrl) {
+		t.Fatalf("Execute() error = %v, want %v", err, wheregoes.ErrInvalidUrl)
+	}
+	if code := ExitCodeOf(err); code != exitCodeInvalidUrl {
+		t.Errorf("ExitCodeOf() = %d, want %d", code, exitCodeInvalidUrl)
+	}
+}
+
+func TestTrackCommandNetworkError(t *testing.T) {
+	// A port nothing listens on anymore.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	_, err = executeTrack("--quiet", "http://"+address)
+	if err == nil {
+		t.Fatal("Execute() error = nil, want the connection error")
+	}
+	if code := ExitCodeOf(err); code != exitCodeNetwork {
+		t.Errorf("ExitCodeOf(%v) = %d, want %d", err, code, exitCodeNetwork)
+	}
+}
+
+func TestTrackCommandQuietRestoresLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if _, err := executeTrack("--quiet", server.URL); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if log.Writer() != &logs {
+		t.Error("--quiet left the global logger silenced")
+	}
+}
+
+// slowChainServer redirects /a to /b, answering each hop after delay, and
+// counts the requests it gets.
+func slowChainServer(t *testing.T, delay time.Duration, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(delay)
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTrackCommandStrictHopBudget(t *testing.T) {
+	var requests atomic.Int32
+	server := slowChainServer(t, 20*time.Millisecond, &requests)
+
+	out, err := executeTrack("--json", "--strict", "--hop-budget", "1ms", server.URL+"/a")
+	if !errors.Is(err, wheregoes.ErrHopOverBudget) {
+		t.Fatalf("Execute() error = %v, want %v", err, wheregoes.ErrHopOverBudget)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("the server got %d requests, want the chain stopped after the first hop", got)
+	}
+
+	// The error follows the JSON document.
+	var response wheregoes.TrackResponse
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&response); err != nil {
+		t.Fatalf("output isn't the partial chain: %v\n%s", err, out)
+	}
+	if len(response.Checkpoints) != 1 || !response.Checkpoints[0].Slow || response.StopReason != err.Error() {
+		t.Errorf("printed %+v, want the slow first hop stopped for %q", response, err)
+	}
+}
+
+func TestTrackCommandHopBudgetKeepsSlowThreshold(t *testing.T) {
+	var requests atomic.Int32
+	server := slowChainServer(t, 20*time.Millisecond, &requests)
+
+	tests := []struct {
+		name string
+		args []string
+		slow bool
+	}{
+		{"hop budget alone", []string{"--hop-budget", "1ms"}, true},
+		{"lower slow threshold", []string{"--hop-budget", "1h", "--slow-threshold", "1ms"}, true},
+		{"higher slow threshold", []string{"--hop-budget", "1ms", "--slow-threshold", "1h"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := executeTrack(append(test.args, "--json", server.URL+"/a")...)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			var response wheregoes.TrackResponse
+			if err := json.Unmarshal([]byte(out), &response); err != nil {
+				t.Fatalf("output isn't a track response: %v\n%s", err, out)
+			}
+			for i, checkpoint := range response.Checkpoints {
+				if checkpoint.Slow != test.slow {
+					t.Errorf("checkpoint %d Slow = %t, want %t", i, checkpoint.Slow, test.slow)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackCommandBasicAuthNotLogged(t *testing.T) {
+	var authorized []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			authorized = append(authorized, r.URL.Path)
+		}
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	secrets := []string{"s3cret", base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))}
+	for _, output := range []string{"", "--summary", "--json", "--json-stream", "--as-curl", "--markdown", "--capture-headers"} {
+		args := []string{"--basic-auth", "alice:s3cret", server.URL + "/a"}
+		if output != "" {
+			args = append(args, output)
+		}
+
+		authorized = nil
+		out, err := executeTrack(args...)
+		if err != nil {
+			t.Fatalf("Execute(%s) error = %v", output, err)
+		}
+
+		if len(authorized) != 2 {
+			t.Errorf("with %s, the server got basic auth on %v, want both same-host hops", output, authorized)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) || strings.Contains(logs.String(), secret) {
+				t.Errorf("with %s, the credentials were printed:\n%s%s", output, out, logs.String())
+			}
+		}
+	}
+}
+
+func TestTrackCommandOutputDirPlainText(t *testing.T) {
+	var requests atomic.Int32
+	server := slowChainServer(t, 0, &requests)
+	dir := t.TempDir()
+
+	if _, err := executeTrack("--output-dir", dir, "--slow-threshold", "1ns", server.URL+"/a"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputFilePath(dir, server.URL+"/a", ".txt"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Contains(string(content), "\x1b[") || !strings.Contains(string(content), "slow") {
+		t.Errorf("the file holds %q, want the hops in plain text", content)
+	}
+}
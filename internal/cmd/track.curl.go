@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// curlTrackPrinter prints a curl command per fetched hop, with the method,
+// headers and body it was requested with, to reproduce the chain by hand one
+// hop at a time. curl doesn't follow redirects unless told to, so each
+// command stops at its hop. Hops that weren't fetched are printed as
+// comments.
+type curlTrackPrinter struct {
+	out io.Writer
+}
+
+func (p *curlTrackPrinter) PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error {
+	if checkpoint.Request == nil {
+		// The note tells why, like "injected, not fetched".
+		note := checkpoint.Note
+		if note == "" {
+			note = "not fetched"
+		}
+		_, err := fmt.Fprintf(p.out, "# %d: %s, %s\n", index, checkpoint.Url, note)
+		return err
+	}
+
+	_, err := fmt.Fprintf(p.out, "# %d: %d\n%s\n", index, checkpoint.Status, curlCommand(checkpoint))
+	return err
+}
+
+func (p *curlTrackPrinter) Finish(wheregoes.TrackChannelResponse) error {
+	return nil
+}
+
+// curlCommand returns the curl command requesting checkpoint's hop the way
+// it was, every argument quoted for POSIX shells. Headers are in name order.
+func curlCommand(checkpoint *wheregoes.TrackCheckpoint) string {
+	args := []string{"curl"}
+	request := checkpoint.Request
+	switch {
+	case checkpoint.Method == http.MethodHead:
+		// -X HEAD would wait for a body that never comes.
+		args = append(args, "--head")
+	case checkpoint.Method == http.MethodPost && request.Body != "":
+	case checkpoint.Method != "" && checkpoint.Method != http.MethodGet:
+		args = append(args, "-X", shellQuote(checkpoint.Method))
+	}
+
+	names := make([]string, 0, len(request.Headers))
+	for name := range request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range request.Headers[name] {
+			args = append(args, "-H", shellQuote(http.CanonicalHeaderKey(name)+": "+value))
+		}
+	}
+
+	if request.Body != "" {
+		args = append(args, "--data-raw", shellQuote(request.Body))
+	}
+
+	args = append(args, shellQuote(checkpoint.Url))
+	return strings.Join(args, " ")
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s as a single POSIX shell word. Within single quotes
+// nothing is special but the single quote itself, which is closed, escaped
+// and reopened.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
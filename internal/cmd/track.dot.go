@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"io"
+)
+
+// dotTrackPrinter prints the chain as a Graphviz DOT graph once it finishes,
+// to be rendered with e.g. `dot -Tpng`. Each url is a single node, so chains
+// revisiting a url draw a cycle instead of repeating it.
+type dotTrackPrinter struct {
+	out io.Writer
+}
+
+func (p *dotTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *dotTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	w := bufio.NewWriter(p.out)
+	fmt.Fprintln(w, "digraph wheregoes {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+
+	nodes := map[string]int{}
+	node := func(url string) int {
+		id, ok := nodes[url]
+		if !ok {
+			id = len(nodes)
+			nodes[url] = id
+			label := url
+			if url == "" {
+				// The checkpoint standing for hops elided by --compact-chain.
+				label = "..."
+			}
+			fmt.Fprintf(w, "\tn%d [label=%q];\n", id, label)
+		}
+		return id
+	}
+
+	checkpoints := finish.Response.Checkpoints
+	for i, checkpoint := range checkpoints {
+		from := node(checkpoint.Url)
+		if i == len(checkpoints)-1 {
+			if checkpoint.Status != 0 {
+				fmt.Fprintf(w, "\tn%d [xlabel=%q];\n", from, hopLabel(checkpoint))
+			}
+			break
+		}
+
+		to := node(checkpoints[i+1].Url)
+		fmt.Fprintf(w, "\tn%d -> n%d [label=%q];\n", from, to, hopLabel(checkpoint))
+	}
+
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
+
+func hopLabel(checkpoint wheregoes.TrackCheckpoint) string {
+	if checkpoint.Elided > 0 {
+		return checkpoint.Note
+	}
+	return fmt.Sprintf("%d, %s", checkpoint.Status, checkpoint.Latency)
+}
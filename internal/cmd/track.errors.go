@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"net"
+)
+
+// Exit codes of the track command, so scripts can branch on why it failed.
+const (
+	exitCodeGeneric          = 1
+	exitCodeInvalidUrl       = 2
+	exitCodeCircularRedirect = 3
+	exitCodeTooManyRedirects = 4
+	exitCodeTimeout          = 5
+	exitCodeNetwork          = 6
+)
+
+const exitCodesHelp = `
+Exit codes:
+  0  success
+  1  any other error
+  2  invalid url
+  3  circular redirect
+  4  too many redirects
+  5  timeout
+  6  network error`
+
+// ExitCodeOf returns the exit code for a command that failed with err.
+func ExitCodeOf(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, wheregoes.ErrInvalidUrl):
+		return exitCodeInvalidUrl
+	case errors.Is(err, wheregoes.ErrCircularRedirection):
+		return exitCodeCircularRedirect
+	case errors.Is(err, wheregoes.ErrTooManyRedirects):
+		return exitCodeTooManyRedirects
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return exitCodeGeneric
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return exitCodeTimeout
+		}
+		return exitCodeNetwork
+	default:
+		return exitCodeGeneric
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/gommon/color"
+	"github.com/mattn/go-isatty"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 100 * time.Millisecond
+
+// isTerminal reports whether out is an interactive terminal.
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// interactiveTrackPrinter renders hops as they resolve, with a spinner on the
+// line of the hop in flight and statuses colored by class.
+type interactiveTrackPrinter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	next    int
+	started time.Time
+	frame   int
+	done    chan struct{}
+	stopped bool
+}
+
+func newInteractiveTrackPrinter(out io.Writer) *interactiveTrackPrinter {
+	p := &interactiveTrackPrinter{
+		out:     out,
+		next:    1,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	go p.spin()
+	return p
+}
+
+func (p *interactiveTrackPrinter) spin() {
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame = (p.frame + 1) % len(spinnerFrames)
+			p.drawSpinner()
+			p.mu.Unlock()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// drawSpinner redraws the in-flight line; callers hold mu.
+func (p *interactiveTrackPrinter) drawSpinner() {
+	_, _ = fmt.Fprintf(
+		p.out,
+		"\r\033[K%s %d ....... resolving (%s)",
+		color.Cyan(spinnerFrames[p.frame]),
+		p.next,
+		time.Since(p.started).Round(time.Millisecond),
+	)
+}
+
+func (p *interactiveTrackPrinter) PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	details := colorStatus(checkpoint.Status, fmt.Sprintf("%d", checkpoint.Status))
+	latency := checkpoint.Latency.String()
+	if checkpoint.Slow {
+		latency = color.Red(latency + ", slow")
+	}
+	details = fmt.Sprintf("%s, %s", details, latency)
+	if checkpoint.Note != "" {
+		details += ", " + checkpoint.Note
+	}
+	if checkpoint.Status == 0 {
+		details = colorStatus(checkpoint.Status, checkpoint.Note)
+	}
+
+	_, err := fmt.Fprintf(p.out, "\r\033[K%s %d ....... %s (%s)\n", statusMark(checkpoint.Status), index, checkpoint.Url, details)
+	p.next = index + 1
+	p.started = time.Now()
+	if !p.stopped {
+		p.drawSpinner()
+	}
+	return err
+}
+
+func (p *interactiveTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	p.Stop()
+
+	return printResponseDetails(p.out, finish.Response)
+}
+
+// Stop halts the spinner and clears its line, so an error can be printed.
+func (p *interactiveTrackPrinter) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+
+	p.stopped = true
+	close(p.done)
+	_, _ = fmt.Fprint(p.out, "\r\033[K")
+}
+
+func statusMark(status int) string {
+	switch {
+	case status == 0:
+		return color.Cyan("→")
+	case status >= 400:
+		return color.Red("✗")
+	case status >= 300:
+		return color.Yellow("↪")
+	default:
+		return color.Green("✓")
+	}
+}
+
+func colorStatus(status int, text string) string {
+	switch {
+	case status == 0:
+		return color.Cyan(text)
+	case status >= 400:
+		return color.Red(text)
+	case status >= 300:
+		return color.Yellow(text)
+	default:
+		return color.Green(text)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/format"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"io"
+	"strings"
+)
+
+// markdownTrackPrinter prints the chain as a Markdown table once it finishes,
+// followed by a summary line, for pasting into issues and docs.
+type markdownTrackPrinter struct {
+	out io.Writer
+}
+
+func (p *markdownTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *markdownTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	response := finish.Response
+	checkpoints := response.Checkpoints
+
+	w := bufio.NewWriter(p.out)
+	fmt.Fprintln(w, "| # | Url | Status | Latency | Note |")
+	fmt.Fprintln(w, "|---|-----|--------|---------|------|")
+	index := 0
+	for _, checkpoint := range checkpoints {
+		index++
+		if checkpoint.Elided > 0 {
+			// Stands for the hops --compact-chain left out.
+			fmt.Fprintf(w, "| %d-%d | | | | %s |\n", index, index+checkpoint.Elided-1, markdownCell(checkpoint.Note))
+			index += checkpoint.Elided - 1
+			continue
+		}
+
+		status, latency := "", ""
+		if checkpoint.Status != 0 {
+			status = fmt.Sprint(checkpoint.Status)
+		}
+		if checkpoint.Status != 0 && !checkpoint.Injected {
+			latency = checkpoint.Latency.String()
+		}
+
+		note := checkpoint.Note
+		if checkpoint.Slow {
+			note = strings.TrimPrefix(note+", slow", ", ")
+		}
+
+		fmt.Fprintf(
+			w,
+			"| %d | %s | %s | %s | %s |\n",
+			index,
+			markdownLink(checkpoint.Url),
+			status,
+			latency,
+			markdownCell(note),
+		)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(
+		w,
+		"**%d hops** from %s to %s\n",
+		response.HopCount(),
+		markdownLink(checkpoints[0].Url),
+		markdownLink(response.Url),
+	)
+
+	for _, detail := range format.Details(response) {
+		fmt.Fprintf(w, "\n**%s:** %s\n", detail.Label, markdownCell(detail.Value))
+	}
+
+	return w.Flush()
+}
+
+// markdownLink renders url as a link to itself, escaping the characters that
+// would end the link text or destination early.
+func markdownLink(url string) string {
+	text := markdownCell(strings.NewReplacer("[", `\[`, "]", `\]`).Replace(url))
+	destination := strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "|", "%7C").Replace(url)
+	return fmt.Sprintf("[%s](%s)", text, destination)
+}
+
+// markdownCell escapes the characters that would break a table cell.
+func markdownCell(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
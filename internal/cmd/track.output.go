@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxOutputNameLength caps the sanitized url part of --output-dir file names,
+// well under the 255 bytes most filesystems allow.
+const maxOutputNameLength = 100
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// outputFilePath returns the file in dir the track of rawUrl is written to
+// with --output-dir: the url without its scheme and with unsafe characters
+// replaced, then a hash of the whole url, so urls sanitized alike, or cut at
+// the same length, still get files of their own. Tracking the same url again
+// replaces its file.
+func outputFilePath(dir string, rawUrl string, ext string) string {
+	name := rawUrl
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	name = strings.Trim(unsafeFileNameChars.ReplaceAllString(name, "_"), "._-")
+	if len(name) > maxOutputNameLength {
+		name = name[:maxOutputNameLength]
+	}
+
+	sum := sha256.Sum256([]byte(rawUrl))
+	hash := hex.EncodeToString(sum[:])[:12]
+	if name == "" {
+		return filepath.Join(dir, hash+ext)
+	}
+	return filepath.Join(dir, name+"-"+hash+ext)
+}
+
+// outputExtension returns the file extension of the output format picked by
+// cmd's flags, checked in the order printerFromFlags picks the printer.
+func outputExtension(cmd *cobra.Command) string {
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+		return ".txt"
+	}
+	if cmd.Flags().Changed("hop") {
+		if jsonOutput {
+			return ".json"
+		}
+		return ".txt"
+	}
+	if count, _ := cmd.Flags().GetBool("count"); count {
+		return ".txt"
+	}
+	if stream, _ := cmd.Flags().GetBool("json-stream"); stream {
+		return ".ndjson"
+	}
+	if jsonOutput {
+		return ".json"
+	}
+	if summary, _ := cmd.Flags().GetBool("summary"); summary {
+		return ".txt"
+	}
+	if dot, _ := cmd.Flags().GetBool("dot"); dot {
+		return ".dot"
+	}
+	if markdown, _ := cmd.Flags().GetBool("markdown"); markdown {
+		return ".md"
+	}
+	if asCurl, _ := cmd.Flags().GetBool("as-curl"); asCurl {
+		return ".sh"
+	}
+	return ".txt"
+}
+
+// outputFilePaths returns the outputFilePath of each of urls, numbering the
+// ones already taken, as by the same url given twice, with -2, -3... so every
+// url of a batch gets a file of its own.
+func outputFilePaths(dir string, urls []string, ext string) []string {
+	paths := make([]string, len(urls))
+	taken := make(map[string]bool, len(urls))
+	for i, rawUrl := range urls {
+		path := outputFilePath(dir, rawUrl, ext)
+		base := strings.TrimSuffix(path, ext)
+		for n := 2; taken[path]; n++ {
+			path = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		taken[path] = true
+		paths[i] = path
+	}
+	return paths
+}
+
+// createOutputFile creates the --output-dir file at path, and its directory
+// when missing.
+func createOutputFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/format"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/gommon/color"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// hopView is the data exposed to track output templates, one per checkpoint.
+type hopView struct {
+	Index        int
+	Url          string
+	Status       int
+	Latency      time.Duration
+	Timestamp    time.Time
+	Domain       string
+	RedirectType wheregoes.RedirectType
+	Note         string
+	Slow         bool
+	Injected     bool
+	Protocol     string
+	Date         *time.Time
+	LastModified *time.Time
+	ServerTiming []wheregoes.ServerTiming
+	Headers      wheregoes.Headers
+}
+
+func newHopView(index int, checkpoint *wheregoes.TrackCheckpoint) hopView {
+	return hopView{
+		Index:        index,
+		Url:          checkpoint.Url,
+		Status:       checkpoint.Status,
+		Latency:      checkpoint.Latency,
+		Timestamp:    checkpoint.Timestamp,
+		Domain:       utils.RegistrableDomain(checkpoint.Url),
+		RedirectType: checkpoint.RedirectType,
+		Note:         checkpoint.Note,
+		Slow:         checkpoint.Slow,
+		Injected:     checkpoint.Injected,
+		Protocol:     checkpoint.Protocol,
+		Date:         checkpoint.Date,
+		LastModified: checkpoint.LastModified,
+		ServerTiming: checkpoint.ServerTiming,
+		Headers:      checkpoint.Headers,
+	}
+}
+
+type trackPrinter interface {
+	PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error
+	Finish(finish wheregoes.TrackChannelResponse) error
+}
+
+type defaultTrackPrinter struct {
+	out   io.Writer
+	color *color.Color
+}
+
+func newDefaultTrackPrinter(out io.Writer) *defaultTrackPrinter {
+	return &defaultTrackPrinter{out: out, color: newColor(out)}
+}
+
+// newColor returns the colors of output printed to out, disabled unless out
+// is a terminal, so files written with --output-dir hold plain text.
+func newColor(out io.Writer) *color.Color {
+	c := new(color.Color)
+	c.SetOutput(out)
+	return c
+}
+
+func (p *defaultTrackPrinter) PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error {
+	paint := p.color.Yellow
+	if checkpoint.Slow {
+		paint = p.color.Red
+	}
+
+	_, err := fmt.Fprint(p.out, paint(format.Hop(index, checkpoint)+"\n"))
+	return err
+}
+
+func (p *defaultTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	return printResponseDetails(p.out, finish.Response)
+}
+
+// printResponseDetails prints the optional details of a finished track, one
+// labelled line each, skipping the ones that weren't filled.
+func printResponseDetails(out io.Writer, response *wheregoes.TrackResponse) error {
+	colors := newColor(out)
+	for _, detail := range format.Details(response) {
+		if _, err := fmt.Fprint(out, colors.Cyan(detail.String()+"\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type templateTrackPrinter struct {
+	out      io.Writer
+	template *template.Template
+}
+
+func (p *templateTrackPrinter) PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error {
+	return p.template.Execute(p.out, newHopView(index, checkpoint))
+}
+
+func (p *templateTrackPrinter) Finish(wheregoes.TrackChannelResponse) error {
+	return nil
+}
+
+// countTrackPrinter prints only the number of redirect hops once the chain
+// finishes.
+type countTrackPrinter struct {
+	out       io.Writer
+	redirects int
+}
+
+func (p *countTrackPrinter) PrintCheckpoint(_ int, checkpoint *wheregoes.TrackCheckpoint) error {
+	if wheregoes.IsRedirectStatus(checkpoint.Status) {
+		p.redirects++
+	}
+	return nil
+}
+
+func (p *countTrackPrinter) Finish(wheregoes.TrackChannelResponse) error {
+	_, err := fmt.Fprintln(p.out, p.redirects)
+	return err
+}
+
+// finalUrlTrackPrinter prints only the final url once the chain finishes.
+type finalUrlTrackPrinter struct {
+	out io.Writer
+}
+
+func (p *finalUrlTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *finalUrlTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	_, err := fmt.Fprintln(p.out, finish.Response.Url)
+	return err
+}
+
+// hopTrackPrinter prints only the url of one hop, or the hop as JSON, once
+// the chain finishes. Negative indexes count from the end, -1 being the final
+// hop.
+type hopTrackPrinter struct {
+	out   io.Writer
+	index int
+	json  bool
+}
+
+func (p *hopTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *hopTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	hops := finish.Response.HopCount()
+	hop := p.index
+	if p.index < 0 {
+		hop = hops + p.index + 1
+	}
+	if hop < 1 || hop > hops {
+		return fmt.Errorf("--hop %d: the chain has %d hops", p.index, hops)
+	}
+
+	checkpoint, ok := checkpointOfHop(finish.Response.Checkpoints, hop)
+	if !ok {
+		return fmt.Errorf("--hop %d was elided by --compact-chain", p.index)
+	}
+
+	if p.json {
+		return json.NewEncoder(p.out).Encode(checkpoint)
+	}
+	_, err := fmt.Fprintln(p.out, checkpoint.Url)
+	return err
+}
+
+// checkpointOfHop returns the checkpoint of hop, numbered from 1, counting
+// the hops elided by --compact-chain, which have none.
+func checkpointOfHop(checkpoints []wheregoes.TrackCheckpoint, hop int) (wheregoes.TrackCheckpoint, bool) {
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Elided == 0 {
+			hop--
+		} else {
+			hop -= checkpoint.Elided
+		}
+		if hop <= 0 {
+			return checkpoint, checkpoint.Elided == 0
+		}
+	}
+	return wheregoes.TrackCheckpoint{}, false
+}
+
+// jsonTrackPrinter prints the whole response as a single JSON document once the
+// chain finishes.
+type jsonTrackPrinter struct {
+	out io.Writer
+}
+
+func (p *jsonTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *jsonTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	return json.NewEncoder(p.out).Encode(finish.Response)
+}
+
+type ndjsonCheckpoint struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	*wheregoes.TrackCheckpoint
+}
+
+type ndjsonSummary struct {
+	Type            string `json:"type"`
+	Url             string `json:"url"`
+	Hops            int    `json:"hops"`
+	ReturnsToOrigin bool   `json:"returnsToOrigin"`
+	StopReason      string `json:"stopReason,omitempty"`
+	FinalTitle      string `json:"finalTitle,omitempty"`
+	CanonicalUrl    string `json:"canonicalUrl,omitempty"`
+	OgUrl           string `json:"ogUrl,omitempty"`
+}
+
+// ndjsonTrackPrinter streams each checkpoint as a JSON line as soon as it's
+// recorded, followed by a line with "type":"summary" once the chain finishes.
+type ndjsonTrackPrinter struct {
+	encoder *json.Encoder
+}
+
+func (p *ndjsonTrackPrinter) PrintCheckpoint(index int, checkpoint *wheregoes.TrackCheckpoint) error {
+	return p.encoder.Encode(ndjsonCheckpoint{
+		Type:            "checkpoint",
+		Index:           index,
+		TrackCheckpoint: checkpoint,
+	})
+}
+
+func (p *ndjsonTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	response := finish.Response
+	return p.encoder.Encode(ndjsonSummary{
+		Type:            "summary",
+		Url:             response.Url,
+		Hops:            response.HopCount(),
+		ReturnsToOrigin: response.ReturnsToOrigin,
+		StopReason:      response.StopReason,
+		FinalTitle:      response.FinalTitle,
+		CanonicalUrl:    response.CanonicalUrl,
+		OgUrl:           response.OgUrl,
+	})
+}
+
+// parseHopTemplate parses a per-hop output template, appending a newline when
+// the template doesn't end with one so each hop prints on its own line.
+func parseHopTemplate(text string) (*template.Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	tmpl, err := template.New("hop").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	// Execute against a sample hop so unknown fields fail before tracking starts.
+	if err = tmpl.Execute(io.Discard, hopView{}); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"io"
+	"strings"
+)
+
+// summaryTrackPrinter prints a compact report once the chain finishes: the
+// input url, the number of hops, the domains passed through on the way, and
+// the final url, optionally without tracking parameters.
+type summaryTrackPrinter struct {
+	out                 io.Writer
+	stripTrackingParams bool
+}
+
+func (p *summaryTrackPrinter) PrintCheckpoint(int, *wheregoes.TrackCheckpoint) error {
+	return nil
+}
+
+func (p *summaryTrackPrinter) Finish(finish wheregoes.TrackChannelResponse) error {
+	response := finish.Response
+	checkpoints := response.Checkpoints
+
+	finalUrl := response.Url
+	if p.stripTrackingParams {
+		finalUrl = utils.StripTrackingParams(finalUrl)
+	}
+
+	via := "none"
+	if domains := intermediateDomains(checkpoints); len(domains) > 0 {
+		via = strings.Join(domains, ", ")
+	}
+
+	_, err := fmt.Fprintf(
+		p.out,
+		"Input: %s\nHops:  %d\nVia:   %s\nFinal: %s\n",
+		checkpoints[0].Url,
+		response.HopCount(),
+		via,
+		finalUrl,
+	)
+	return err
+}
+
+// intermediateDomains returns the registrable domains of the hops between the
+// first and the last, in order and without duplicates, leaving out the
+// domains of the input and final urls.
+func intermediateDomains(checkpoints []wheregoes.TrackCheckpoint) []string {
+	if len(checkpoints) < 3 {
+		return nil
+	}
+
+	ends := map[string]bool{
+		utils.RegistrableDomain(checkpoints[0].Url):                  true,
+		utils.RegistrableDomain(checkpoints[len(checkpoints)-1].Url): true,
+	}
+
+	var domains []string
+	seen := map[string]bool{}
+	for _, checkpoint := range checkpoints[1 : len(checkpoints)-1] {
+		domain := utils.RegistrableDomain(checkpoint.Url)
+		if domain == "" || ends[domain] || seen[domain] {
+			continue
+		}
+
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/gommon/color"
+	"io"
+	"strings"
+	"time"
+)
+
+// watchResult is what --watch compares from one run to the next.
+type watchResult struct {
+	finalUrl string
+	hops     int
+	err      string
+}
+
+func newWatchResult(response wheregoes.TrackResponse, err error) watchResult {
+	if err != nil {
+		return watchResult{err: err.Error()}
+	}
+	return watchResult{finalUrl: response.Url, hops: response.HopCount()}
+}
+
+// changes describes how r differs from previous, empty when it doesn't.
+func (r watchResult) changes(previous watchResult) []string {
+	var changes []string
+	if r.err != previous.err {
+		switch {
+		case r.err == "":
+			changes = append(changes, "recovered")
+		case previous.err == "":
+			changes = append(changes, "started failing")
+		default:
+			changes = append(changes, "error changed")
+		}
+	}
+	if r.err == "" && previous.err == "" {
+		if r.finalUrl != previous.finalUrl {
+			changes = append(changes, "final url was "+previous.finalUrl)
+		}
+		if r.hops != previous.hops {
+			changes = append(changes, fmt.Sprintf("hops were %d", previous.hops))
+		}
+	}
+	return changes
+}
+
+// watchTrack tracks initialUrl every interval until ctx is cancelled, e.g. on
+// Ctrl-C, printing a timestamped line with the final url and hop count of the
+// first run and of every run where either changed, highlighting what did. With
+// all, unchanged runs are printed too. Failed runs count as a change when the
+// previous one succeeded or failed otherwise.
+func watchTrack(ctx context.Context, service wheregoes.TrackerService, initialUrl string, interval time.Duration, all bool, out io.Writer) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous watchResult
+	for run := 1; ; run++ {
+		response, err := service.Track(ctx, initialUrl)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		result := newWatchResult(response, err)
+		var changes []string
+		if run > 1 {
+			changes = result.changes(previous)
+		}
+		if run == 1 || len(changes) > 0 || all {
+			if err := printWatchResult(out, time.Now(), result, changes); err != nil {
+				return err
+			}
+		}
+		previous = result
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func printWatchResult(out io.Writer, at time.Time, result watchResult, changes []string) error {
+	line := fmt.Sprintf("%s (%d hops)", result.finalUrl, result.hops)
+	if result.hops == 1 {
+		line = result.finalUrl + " (1 hop)"
+	}
+	if result.err != "" {
+		line = color.Red("Error: " + result.err)
+	}
+	if len(changes) > 0 {
+		line += " " + color.Yellow("changed: "+strings.Join(changes, ", "))
+	}
+
+	_, err := fmt.Fprintf(out, "%s %s\n", at.Format(time.RFC3339), line)
+	return err
+}
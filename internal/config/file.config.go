@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultFileName is looked up in the working directory when no config file is
+// given explicitly.
+const DefaultFileName = "wheregoes.yaml"
+
+// File holds the settings read from a config file, keyed by flag name. List
+// values are joined with commas, the same way they're passed on the command
+// line.
+type File map[string]string
+
+// LoadFile reads a config file from path.
+func LoadFile(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Parse reads flat "key: value" (YAML) or "key = value" (TOML) settings. Lists
+// can be written inline as [a, b] or, in YAML, as "- item" lines below an
+// empty key. Keys use the flag names, with underscores accepted in place of
+// dashes. Nested sections aren't supported.
+func Parse(r io.Reader) (File, error) {
+	file := File{}
+	listKey := ""
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNumber)
+			}
+
+			item := unquote(strings.TrimSpace(line[2:]))
+			if file[listKey] == "" {
+				file[listKey] = item
+			} else {
+				file[listKey] += "," + item
+			}
+			continue
+		}
+
+		key, value, ok := splitKeyValue(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNumber)
+		}
+
+		key = strings.ReplaceAll(key, "_", "-")
+		listKey = ""
+		if value == "" {
+			listKey = key
+		}
+
+		file[key] = parseValue(value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func splitKeyValue(line string) (string, string, bool) {
+	i := strings.IndexAny(line, ":=")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+func parseValue(value string) string {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		items := strings.Split(value[1:len(value)-1], ",")
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			if item = unquote(strings.TrimSpace(item)); item != "" {
+				values = append(values, item)
+			}
+		}
+		return strings.Join(values, ",")
+	}
+
+	return unquote(value)
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// stripComment drops a trailing "# comment" that isn't inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,65 @@
+// Package format renders tracks as plain text, shared by the CLI's default
+// output and the server's text/plain responses so they read alike.
+package format
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+)
+
+// Hop renders checkpoint, the index-th hop of a chain, as a line without its
+// trailing newline, like "1 ....... https://a.com (301, 52ms)".
+func Hop(index int, checkpoint *wheregoes.TrackCheckpoint) string {
+	return fmt.Sprintf("%d ....... %s (%s)", index, checkpoint.Url, hopDetails(checkpoint))
+}
+
+// hopDetails returns the status and latency of checkpoint, its note and
+// whether it was slow. Hops that weren't fetched only have a note.
+func hopDetails(checkpoint *wheregoes.TrackCheckpoint) string {
+	details := fmt.Sprintf("%d, %s", checkpoint.Status, checkpoint.Latency)
+	if checkpoint.Status == 0 {
+		details = checkpoint.Note
+	} else if checkpoint.Injected {
+		// Injected hops weren't fetched, so they have no latency.
+		details = fmt.Sprintf("%d, %s", checkpoint.Status, checkpoint.Note)
+	} else if checkpoint.Note != "" {
+		details += ", " + checkpoint.Note
+	}
+
+	if checkpoint.Slow {
+		details += ", slow"
+	}
+	return details
+}
+
+// Detail is an optional detail of a finished track, like its title.
+type Detail struct {
+	Label string
+	Value string
+}
+
+// String renders the detail as a labelled line, without its trailing
+// newline.
+func (d Detail) String() string {
+	return d.Label + ": " + d.Value
+}
+
+// Details returns the optional details of a finished track that were filled,
+// in print order.
+func Details(response *wheregoes.TrackResponse) []Detail {
+	details := []Detail{
+		{"Stopped", response.StopReason},
+		{"Title", response.FinalTitle},
+		{"Canonical", response.CanonicalUrl},
+		{"og:url", response.OgUrl},
+		{"Error body", response.ErrorBody},
+	}
+
+	filled := details[:0]
+	for _, detail := range details {
+		if detail.Value != "" {
+			filled = append(filled, detail)
+		}
+	}
+	return filled
+}
@@ -0,0 +1,41 @@
+package format
+
+import (
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHop(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint wheregoes.TrackCheckpoint
+		want       string
+	}{
+		{"fetched", wheregoes.TrackCheckpoint{Url: "https://a.com", Status: 301, Latency: 52 * time.Millisecond}, "2 ....... https://a.com (301, 52ms)"},
+		{"note", wheregoes.TrackCheckpoint{Url: "https://a.com", Status: 302, Latency: time.Second, Note: "meta refresh"}, "2 ....... https://a.com (302, 1s, meta refresh)"},
+		{"slow", wheregoes.TrackCheckpoint{Url: "https://a.com", Status: 200, Latency: time.Second, Slow: true}, "2 ....... https://a.com (200, 1s, slow)"},
+		{"not fetched", wheregoes.TrackCheckpoint{Url: "https://b.com", Note: "other domain, not fetched"}, "2 ....... https://b.com (other domain, not fetched)"},
+		{"injected", wheregoes.TrackCheckpoint{Url: "https://s.io", Status: 301, Note: "injected, not fetched", Injected: true}, "2 ....... https://s.io (301, injected, not fetched)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Hop(2, &test.checkpoint); got != test.want {
+				t.Errorf("Hop() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDetails(t *testing.T) {
+	response := &wheregoes.TrackResponse{StopReason: "stop-at matched", OgUrl: "https://a.com/og"}
+
+	want := []Detail{{"Stopped", "stop-at matched"}, {"og:url", "https://a.com/og"}}
+	if got := Details(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("Details() = %v, want %v", got, want)
+	}
+	if got := want[0].String(); got != "Stopped: stop-at matched" {
+		t.Errorf("String() = %q, want %q", got, "Stopped: stop-at matched")
+	}
+}
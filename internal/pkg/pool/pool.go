@@ -0,0 +1,52 @@
+// Package pool runs batches of tasks with a bounded number of them at once.
+package pool
+
+import (
+	"expvar"
+	"sync"
+)
+
+// Pool runs at most a fixed number of tasks of a batch at once, counting the
+// running ones in an optional gauge that may be shared by several pools.
+type Pool struct {
+	concurrency int
+	inFlight    *expvar.Int
+}
+
+// New returns a pool running up to concurrency tasks at once, at least one.
+// inFlight, when not nil, is kept to the number of tasks running.
+func New(concurrency int, inFlight *expvar.Int) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Pool{concurrency: concurrency, inFlight: inFlight}
+}
+
+// Run calls task with each index from 0 to n-1, starting them in order as
+// slots free up, and returns once all of them returned. A task frees its
+// slot however it ends, so a failing one can't hold the others up.
+func (p *Pool) Run(n int, task func(i int)) {
+	var tasks sync.WaitGroup
+	slots := make(chan struct{}, p.concurrency)
+	for i := 0; i < n; i++ {
+		i := i
+		tasks.Add(1)
+		slots <- struct{}{}
+		p.add(1)
+		go func() {
+			defer func() {
+				p.add(-1)
+				<-slots
+				tasks.Done()
+			}()
+			task(i)
+		}()
+	}
+	tasks.Wait()
+}
+
+func (p *Pool) add(delta int64) {
+	if p.inFlight != nil {
+		p.inFlight.Add(delta)
+	}
+}
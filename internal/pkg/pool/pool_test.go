@@ -0,0 +1,91 @@
+package pool
+
+import (
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolRun(t *testing.T) {
+	const tasks, concurrency = 100, 4
+
+	inFlight := new(expvar.Int)
+	var (
+		mu          sync.Mutex
+		running     int
+		maxRunning  int
+		maxInFlight int64
+		ran         = make([]int, tasks)
+	)
+	New(concurrency, inFlight).Run(tasks, func(i int) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if gauge := inFlight.Value(); gauge > maxInFlight {
+			maxInFlight = gauge
+		}
+		ran[i]++
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if maxRunning > concurrency || maxInFlight > concurrency {
+		t.Errorf("up to %d tasks ran at once, with the gauge up to %d, want at most %d", maxRunning, maxInFlight, concurrency)
+	}
+	if maxRunning < 2 {
+		t.Errorf("up to %d tasks ran at once, want them concurrent", maxRunning)
+	}
+	for i, runs := range ran {
+		if runs != 1 {
+			t.Errorf("task %d ran %d times, want once", i, runs)
+		}
+	}
+	if gauge := inFlight.Value(); gauge != 0 {
+		t.Errorf("the gauge is at %d once done, want 0", gauge)
+	}
+}
+
+func TestPoolRunSharedGauge(t *testing.T) {
+	inFlight := new(expvar.Int)
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(4)
+
+	var pools sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		pools.Add(1)
+		go func() {
+			defer pools.Done()
+			New(2, inFlight).Run(2, func(int) {
+				started.Done()
+				<-release
+			})
+		}()
+	}
+
+	started.Wait()
+	if gauge := inFlight.Value(); gauge != 4 {
+		t.Errorf("the gauge is at %d with two pools of 2 running, want 4", gauge)
+	}
+	close(release)
+	pools.Wait()
+	if gauge := inFlight.Value(); gauge != 0 {
+		t.Errorf("the gauge is at %d once done, want 0", gauge)
+	}
+}
+
+func TestPoolRunWithoutGauge(t *testing.T) {
+	ran := 0
+	New(0, nil).Run(3, func(int) { ran++ })
+	if ran != 3 {
+		t.Errorf("ran %d tasks, want 3", ran)
+	}
+}
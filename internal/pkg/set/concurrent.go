@@ -0,0 +1,78 @@
+package set
+
+import "sync"
+
+// concurrentSet guards a set with a RWMutex, so it can be shared between
+// goroutines.
+type concurrentSet[T comparable] struct {
+	mu sync.RWMutex
+	s  set[T]
+}
+
+func (c *concurrentSet[T]) Add(t T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.Add(t)
+}
+
+func (c *concurrentSet[T]) AddAll(items ...T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.AddAll(items...)
+}
+
+func (c *concurrentSet[T]) Remove(t T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.s.Remove(t)
+}
+
+func (c *concurrentSet[T]) Contains(t T) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Contains(t)
+}
+
+func (c *concurrentSet[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Len()
+}
+
+func (c *concurrentSet[T]) IsEmpty() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.IsEmpty()
+}
+
+func (c *concurrentSet[T]) Values() []T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.s.Values()
+}
+
+// Clone returns a concurrent copy of the set.
+func (c *concurrentSet[T]) Clone() Set[T] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &concurrentSet[T]{s: *c.s.Clone().(*set[T])}
+}
+
+func (c *concurrentSet[T]) Equal(other Set[T]) bool {
+	if other == Set[T](c) {
+		return true
+	}
+
+	// Compare against a snapshot, so other is never locked while c is.
+	return NewFromSlice(c.Values()).Equal(other)
+}
+
+// NewConcurrent returns a Set safe for use by several goroutines at once,
+// like a visited set shared by concurrent tracks. A set used by a single
+// goroutine, like the one a track keeps for itself, should use New instead,
+// which doesn't pay for locking.
+func NewConcurrent[T comparable]() Set[T] {
+	return &concurrentSet[T]{
+		s: set[T]{m: make(map[T]struct{})},
+	}
+}
@@ -0,0 +1,57 @@
+package set
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentSetParallelUse is meant to run with -race: every method is
+// called from many goroutines at once.
+func TestConcurrentSetParallelUse(t *testing.T) {
+	const goroutines, items = 32, 200
+
+	s := NewConcurrent[string]()
+	other := NewConcurrent[string]()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				item := strconv.Itoa(i)
+				s.Add(item)
+				s.AddAll(item, "g"+strconv.Itoa(g))
+				s.Contains(item)
+				s.Len()
+				s.IsEmpty()
+				s.Values()
+				s.Clone().Add("clone-only")
+				s.Equal(other)
+				other.Equal(s)
+				s.Remove("g" + strconv.Itoa(g))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.Len() != items {
+		t.Fatalf("Len() = %d, want %d", s.Len(), items)
+	}
+	if s.Contains("clone-only") {
+		t.Error("an item added to a clone leaked into the original")
+	}
+}
+
+func TestConcurrentSetEqualItself(t *testing.T) {
+	s := NewConcurrent[int]()
+	s.AddAll(1, 2, 3)
+
+	if !s.Equal(s) {
+		t.Error("Equal(itself) = false, want true")
+	}
+	if !s.Equal(NewFromSlice([]int{3, 2, 1})) {
+		t.Error("Equal(plain set with the same items) = false, want true")
+	}
+}
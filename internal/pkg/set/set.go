@@ -2,10 +2,15 @@ package set
 
 type Set[T comparable] interface {
 	Add(T)
+	// AddAll adds every item at once.
+	AddAll(items ...T)
 	Remove(T)
 	Contains(T) bool
 	Len() int
+	IsEmpty() bool
 	Values() []T
+	Clone() Set[T]
+	Equal(other Set[T]) bool
 }
 
 type set[T comparable] struct {
@@ -16,6 +21,12 @@ func (s set[T]) Add(t T) {
 	s.m[t] = struct{}{}
 }
 
+func (s set[T]) AddAll(items ...T) {
+	for _, item := range items {
+		s.m[item] = struct{}{}
+	}
+}
+
 func (s set[T]) Remove(t T) {
 	delete(s.m, t)
 }
@@ -29,6 +40,10 @@ func (s set[T]) Len() int {
 	return len(s.m)
 }
 
+func (s set[T]) IsEmpty() bool {
+	return len(s.m) == 0
+}
+
 func (s set[T]) Values() []T {
 	values := make([]T, 0, len(s.m))
 	for k := range s.m {
@@ -37,8 +52,38 @@ func (s set[T]) Values() []T {
 	return values
 }
 
+func (s set[T]) Clone() Set[T] {
+	clone := &set[T]{
+		m: make(map[T]struct{}, len(s.m)),
+	}
+	for k := range s.m {
+		clone.m[k] = struct{}{}
+	}
+	return clone
+}
+
+func (s set[T]) Equal(other Set[T]) bool {
+	if other == nil || s.Len() != other.Len() {
+		return false
+	}
+	for k := range s.m {
+		if !other.Contains(k) {
+			return false
+		}
+	}
+	return true
+}
+
 func New[T comparable]() Set[T] {
 	return &set[T]{
 		m: make(map[T]struct{}),
 	}
 }
+
+func NewFromSlice[T comparable](items []T) Set[T] {
+	s := &set[T]{
+		m: make(map[T]struct{}, len(items)),
+	}
+	s.AddAll(items...)
+	return s
+}
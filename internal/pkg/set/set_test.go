@@ -0,0 +1,105 @@
+package set
+
+import (
+	"sort"
+	"testing"
+)
+
+func sortedValues(s Set[string]) []string {
+	values := s.Values()
+	sort.Strings(values)
+	return values
+}
+
+func TestNewFromSliceCollapsesDuplicates(t *testing.T) {
+	s := NewFromSlice([]string{"a", "b", "a", "c", "b", "a"})
+
+	if s.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", s.Len())
+	}
+	for _, item := range []string{"a", "b", "c"} {
+		if !s.Contains(item) {
+			t.Errorf("Contains(%q) = false, want true", item)
+		}
+	}
+}
+
+func TestNewFromSliceEmpty(t *testing.T) {
+	for _, items := range [][]string{nil, {}} {
+		if s := NewFromSlice(items); s.Len() != 0 {
+			t.Errorf("NewFromSlice(%#v).Len() = %d, want 0", items, s.Len())
+		}
+	}
+}
+
+func TestCloneDoesNotAlias(t *testing.T) {
+	original := NewFromSlice([]string{"a", "b"})
+	clone := original.Clone()
+
+	clone.Add("c")
+	clone.Remove("a")
+
+	if got := sortedValues(original); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("original = %v after mutating the clone, want [a b]", got)
+	}
+	if got := sortedValues(clone); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("clone = %v, want [b c]", got)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		equal bool
+	}{
+		{"equal", []string{"a", "b"}, []string{"b", "a"}, true},
+		{"both empty", nil, nil, true},
+		{"subset", []string{"a"}, []string{"a", "b"}, false},
+		{"superset", []string{"a", "b"}, []string{"a"}, false},
+		{"same length, disjoint", []string{"a", "b"}, []string{"c", "d"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := NewFromSlice(test.a), NewFromSlice(test.b)
+			if got := a.Equal(b); got != test.equal {
+				t.Errorf("%v.Equal(%v) = %t, want %t", test.a, test.b, got, test.equal)
+			}
+		})
+	}
+
+	if NewFromSlice([]string{"a"}).Equal(nil) {
+		t.Error("Equal(nil) = true, want false")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	s := New[string]()
+	if !s.IsEmpty() {
+		t.Fatal("IsEmpty() = false on a new set, want true")
+	}
+
+	s.Add("a")
+	if s.IsEmpty() {
+		t.Fatal("IsEmpty() = true after Add, want false")
+	}
+
+	s.Remove("a")
+	if !s.IsEmpty() {
+		t.Fatal("IsEmpty() = false after removing the only item, want true")
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	s := NewFromSlice([]string{"a"})
+	s.AddAll("a", "b", "c", "b")
+
+	if got := sortedValues(s); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("values = %v, want [a b c]", got)
+	}
+
+	s.AddAll()
+	if s.Len() != 3 {
+		t.Errorf("Len() = %d after AddAll(), want 3", s.Len())
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http/httpguts"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// BindAddress is the IP the server listens on. Empty binds all interfaces.
+	BindAddress string
+	// Port 0 listens on a port picked by the OS, which is logged and written
+	// to PortFile when set.
+	Port     string
+	PortFile string
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// HTTPRedirectPort, when set alongside TLS, starts a plain HTTP listener
+	// that redirects every request to the HTTPS port.
+	HTTPRedirectPort string
+	// GRPCPort, when set, starts a gRPC listener serving the Tracker service
+	// of trackerpb, streaming tracks like the websocket. It uses TLS when the
+	// HTTP server does.
+	GRPCPort string
+	// MaxConcurrentTracks caps tracks running at once across /tracks and the
+	// websocket. Zero means unlimited.
+	MaxConcurrentTracks int
+	// BatchConcurrency caps the urls of a single websocket message tracked at
+	// once, so a batch can't exhaust file descriptors on its own. Zero means
+	// DefaultBatchConcurrency.
+	BatchConcurrency int
+	// WSMaxRedirects caps the redirects a websocket track follows, stricter
+	// than /tracks since the websocket is what public pages call. Longer
+	// chains fail with a TOO_MANY_REDIRECTS error. Zero means
+	// DefaultWSMaxRedirects.
+	WSMaxRedirects int
+	// AllowedOrigins lists the browser origins allowed to call the API ("*"
+	// allows any). When empty CORS is disabled and websockets only accept
+	// same-origin requests.
+	AllowedOrigins []string
+	// CORSAllowMethods and CORSAllowHeaders are the methods and request
+	// headers allowed cross-origin. Empty means DefaultCORSAllowMethods, and
+	// DefaultCORSAllowHeaders plus the request ID header.
+	CORSAllowMethods []string
+	CORSAllowHeaders []string
+	// CORSAllowCredentials lets browsers send cookies and HTTP auth along
+	// cross-origin requests. It can't be combined with the "*" origin.
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers may cache a preflight response. Zero
+	// leaves it to the browser's default.
+	CORSMaxAge time.Duration
+	// RequestIDHeader is the header a request's ID is read from, to correlate
+	// it with the caller's systems, and echoed in. An ID is generated when the
+	// request has none. It tags the server's log lines about the request.
+	// Empty means DefaultRequestIDHeader.
+	RequestIDHeader string
+	// AllowedPorts restricts the ports tracked hops may be fetched from, like
+	// 80 and 443, so the server can't be used to reach internal services on
+	// other ports. Empty allows any port.
+	AllowedPorts []int
+	// TrackLogFile, when set, is appended a JSON line per track with its
+	// urls, hops, final status and client IP, as an audit trail. It's rotated
+	// to TrackLogFile + ".1" before growing past TrackLogMaxSize bytes, unless
+	// that's zero.
+	TrackLogFile    string
+	TrackLogMaxSize int64
+	// IdleConnCleanupInterval is how often connections to tracked hosts left
+	// idle are closed, so a server running for weeks doesn't pile up
+	// connections to hosts it visited once. Zero means
+	// DefaultIdleConnCleanupInterval.
+	IdleConnCleanupInterval time.Duration
+	// IdleConnTimeout closes connections idle for longer than it on top of the
+	// periodic cleanup. Zero means wheregoes.DefaultIdleConnTimeout.
+	IdleConnTimeout time.Duration
+	// ServeUI serves a web page at / that tracks urls over the websocket and
+	// draws the chain as it resolves, for demos without a separate frontend.
+	ServeUI bool
+	// ServeMetrics serves the process's expvar variables as JSON at
+	// /debug/vars, like batch_tracks_in_flight, for monitoring.
+	ServeMetrics bool
+}
+
+// DefaultBatchConcurrency is how many urls of a single websocket message are
+// tracked at once by default.
+const DefaultBatchConcurrency = 4
+
+// DefaultWSMaxRedirects is how many redirects a websocket track follows by
+// default, plenty for shorteners and tracking links.
+const DefaultWSMaxRedirects = 10
+
+// DefaultIdleConnCleanupInterval is how often idle connections are closed by
+// default.
+const DefaultIdleConnCleanupInterval = 5 * time.Minute
+
+// DefaultCORSAllowMethods are the methods allowed cross-origin by default.
+var DefaultCORSAllowMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+
+// DefaultCORSAllowHeaders are the request headers allowed cross-origin by
+// default, besides the request ID header.
+var DefaultCORSAllowHeaders = []string{echo.HeaderContentType, echo.HeaderAuthorization}
+
+// DefaultRequestIDHeader is the header request IDs are read from and echoed
+// in by default.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+func DefaultConfig() Config {
+	return Config{
+		Port:            "8080",
+		RequestIDHeader: DefaultRequestIDHeader,
+	}
+}
+
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Validate checks the config for errors that would only surface once the
+// server starts listening.
+func (c Config) Validate() error {
+	if _, err := c.Address(); err != nil {
+		return err
+	}
+
+	if c.MaxConcurrentTracks < 0 {
+		return fmt.Errorf("invalid max concurrent tracks %d", c.MaxConcurrentTracks)
+	}
+
+	if c.BatchConcurrency < 0 {
+		return fmt.Errorf("invalid batch concurrency %d", c.BatchConcurrency)
+	}
+
+	if c.WSMaxRedirects < 0 {
+		return fmt.Errorf("invalid websocket max redirects %d", c.WSMaxRedirects)
+	}
+
+	if c.RequestIDHeader != "" && !httpguts.ValidHeaderFieldName(c.RequestIDHeader) {
+		return fmt.Errorf("invalid request ID header %q", c.RequestIDHeader)
+	}
+
+	for _, port := range c.AllowedPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid allowed port %d", port)
+		}
+	}
+
+	if c.TrackLogMaxSize < 0 {
+		return fmt.Errorf("invalid track log max size %d", c.TrackLogMaxSize)
+	}
+
+	for _, method := range c.CORSAllowMethods {
+		if method = strings.TrimSpace(method); !httpguts.ValidHeaderFieldName(method) {
+			return fmt.Errorf("invalid CORS method %q", method)
+		}
+	}
+
+	for _, header := range c.CORSAllowHeaders {
+		if header = strings.TrimSpace(header); !httpguts.ValidHeaderFieldName(header) {
+			return fmt.Errorf("invalid CORS header %q", header)
+		}
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if c.CORSAllowCredentials && strings.TrimSpace(origin) == "*" {
+			return fmt.Errorf("CORS credentials can't be allowed for any origin, list the allowed origins instead")
+		}
+	}
+
+	if c.IdleConnCleanupInterval < 0 {
+		return fmt.Errorf("invalid idle connection cleanup interval %s", c.IdleConnCleanupInterval)
+	}
+
+	if c.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid idle connection timeout %s", c.IdleConnTimeout)
+	}
+
+	if c.CORSMaxAge < 0 {
+		return fmt.Errorf("invalid CORS max age %s", c.CORSMaxAge)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("both a TLS certificate and key are required to serve HTTPS")
+	}
+
+	if c.GRPCPort != "" {
+		if _, err := c.grpcAddress(); err != nil {
+			return err
+		}
+	}
+
+	if c.HTTPRedirectPort != "" {
+		if !c.TLSEnabled() {
+			return fmt.Errorf("an HTTP redirect port requires TLS to be enabled")
+		}
+
+		if _, err := c.redirectAddress(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Address validates the config and returns the address to listen on.
+func (c Config) Address() (string, error) {
+	port, err := strconv.Atoi(c.Port)
+	if err != nil || port < 0 || port > 65535 {
+		return "", fmt.Errorf("invalid port %q", c.Port)
+	}
+
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil {
+		return "", fmt.Errorf("invalid bind address %q: expected an IP address", c.BindAddress)
+	}
+
+	return net.JoinHostPort(c.BindAddress, c.Port), nil
+}
+
+func (c Config) redirectAddress() (string, error) {
+	return Config{BindAddress: c.BindAddress, Port: c.HTTPRedirectPort}.Address()
+}
+
+func (c Config) grpcAddress() (string, error) {
+	return Config{BindAddress: c.BindAddress, Port: c.GRPCPort}.Address()
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"net"
+	"net/http"
+)
+
+// errorCode is the machine-readable counterpart of an error message, so
+// clients don't have to match on free text.
+type errorCode string
+
+const (
+	errorCodeCircularRedirect errorCode = "CIRCULAR_REDIRECT"
+	errorCodeTooManyRedirects errorCode = "TOO_MANY_REDIRECTS"
+	errorCodeTimeout          errorCode = "TIMEOUT"
+	errorCodeOverBudget       errorCode = "OVER_BUDGET"
+	errorCodeNetwork          errorCode = "NETWORK"
+	errorCodeInvalidUrl       errorCode = "INVALID_URL"
+	errorCodeInvalidRequest   errorCode = "INVALID_REQUEST"
+	errorCodeServerBusy       errorCode = "SERVER_BUSY"
+	errorCodeInternal         errorCode = "INTERNAL"
+)
+
+func errorCodeOf(err error) errorCode {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, wheregoes.ErrCircularRedirection):
+		return errorCodeCircularRedirect
+	case errors.Is(err, wheregoes.ErrTooManyRedirects):
+		return errorCodeTooManyRedirects
+	case errors.Is(err, errServerBusy):
+		return errorCodeServerBusy
+	case errors.Is(err, wheregoes.ErrInvalidUrl):
+		return errorCodeInvalidUrl
+	case wheregoes.IsPartialChainError(err):
+		return errorCodeOverBudget
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorCodeTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return errorCodeTimeout
+		}
+		return errorCodeNetwork
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, errTooManyUrls):
+		return errorCodeInvalidRequest
+	default:
+		return errorCodeInternal
+	}
+}
+
+func (c errorCode) httpStatus() int {
+	switch c {
+	case errorCodeCircularRedirect, errorCodeTooManyRedirects:
+		return http.StatusConflict
+	case errorCodeInvalidUrl, errorCodeInvalidRequest:
+		return http.StatusBadRequest
+	case errorCodeTimeout, errorCodeOverBudget:
+		return http.StatusGatewayTimeout
+	case errorCodeNetwork:
+		return http.StatusBadGateway
+	case errorCodeServerBusy:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/server/trackerpb"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// grpcTracker serves the Tracker gRPC service, which streams tracks like the
+// websocket does, for gRPC-native backends.
+type grpcTracker struct {
+	trackerpb.UnimplementedTrackerServer
+	// ctx is the server's, done once it shuts down.
+	ctx             context.Context
+	service         wheregoes.TrackerService
+	limiter         *trackLimiter
+	auditLog        *trackLog
+	requestIDHeader string
+}
+
+func (s *grpcTracker) Track(request *trackerpb.TrackRequest, stream trackerpb.Tracker_TrackServer) error {
+	trackUrl, err := parseTrackUrl(request.Url)
+	if err != nil {
+		return stream.Send(newGrpcErrorEvent(err))
+	}
+	request.Url = trackUrl
+
+	if !s.limiter.TryAcquire() {
+		return stream.Send(newGrpcErrorEvent(errServerBusy))
+	}
+	defer s.limiter.Release()
+
+	ctx, cancel := trackContext(stream.Context(), s.ctx)
+	defer cancel()
+
+	clientIP, requestID := grpcClientIP(ctx), grpcRequestID(ctx, s.requestIDHeader)
+	record := func(response *wheregoes.TrackResponse, err error) {
+		if err := s.auditLog.record(clientIP, requestID, request.Url, response, err); err != nil {
+			log.Printf("[%s] Error writing the track log: %v", requestID, err)
+		}
+	}
+
+	for response := range s.service.TrackChannel(ctx, request.Url) {
+		switch {
+		case response.Err != nil:
+			record(nil, response.Err)
+			if errorCodeOf(response.Err) == errorCodeInternal {
+				log.Printf("[%s] Error tracking %s: %v", requestID, request.Url, response.Err)
+			}
+			return stream.Send(newGrpcErrorEvent(response.Err))
+		case response.Finished:
+			record(response.Response, nil)
+			return stream.Send(&trackerpb.TrackEvent{
+				Event: &trackerpb.TrackEvent_Finish{Finish: &trackerpb.Finish{
+					Url:        response.Response.Url,
+					StopReason: response.Response.StopReason,
+				}},
+			})
+		default:
+			if err := stream.Send(newGrpcCheckpointEvent(response.Checkpoint)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The channel closes without a last message once ctx is cancelled, as the
+	// client goes away or the server shuts down.
+	return ctx.Err()
+}
+
+func newGrpcErrorEvent(err error) *trackerpb.TrackEvent {
+	response := newTrackErrorResponse(err)
+	return &trackerpb.TrackEvent{
+		Event: &trackerpb.TrackEvent_Error{Error: &trackerpb.Error{
+			Error: response.Error,
+			Code:  string(response.Code),
+		}},
+	}
+}
+
+func newGrpcCheckpointEvent(checkpoint *wheregoes.TrackCheckpoint) *trackerpb.TrackEvent {
+	return &trackerpb.TrackEvent{
+		Event: &trackerpb.TrackEvent_Checkpoint{Checkpoint: &trackerpb.Checkpoint{
+			Url:          checkpoint.Url,
+			Status:       int32(checkpoint.Status),
+			Latency:      durationpb.New(checkpoint.Latency),
+			RedirectType: string(checkpoint.RedirectType),
+			Timestamp:    timestamppb.New(checkpoint.Timestamp),
+			Method:       checkpoint.Method,
+			Protocol:     checkpoint.Protocol,
+			Note:         checkpoint.Note,
+			Slow:         checkpoint.Slow,
+			Injected:     checkpoint.Injected,
+			HostChanged:  checkpoint.HostChanged,
+			PathChanged:  checkpoint.PathChanged,
+			QueryChanged: checkpoint.QueryChanged,
+		}},
+	}
+}
+
+// grpcClientIP returns the IP of the client of the call ctx belongs to.
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// grpcRequestID returns the request ID the client sent in the metadata key
+// header, like the HTTP API reads it from the header, if any.
+func grpcRequestID(ctx context.Context, header string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(strings.ToLower(header)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// serveGRPC listens on the gRPC port and serves tracker on it, over TLS when
+// the config enables it, until ctx is done.
+func serveGRPC(ctx context.Context, config Config, tracker *grpcTracker) error {
+	address, err := config.grpcAddress()
+	if err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	if config.TLSEnabled() {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	trackerpb.RegisterTrackerServer(grpcServer, tracker)
+	go func() {
+		<-ctx.Done()
+
+		// GracefulStop waits for running tracks, which end once ctx is done.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			grpcServer.Stop()
+		}
+	}()
+
+	log.Println("Serving gRPC on", address)
+	return grpcServer.Serve(listener)
+}
@@ -0,0 +1,48 @@
+package server
+
+import "errors"
+
+var errServerBusy = errors.New("too many concurrent tracks, retry later")
+
+// retryAfterSeconds is suggested to clients rejected because the server is at
+// its concurrent tracks limit.
+const retryAfterSeconds = "1"
+
+// trackLimiter caps the number of tracks running at once across the server.
+// A nil trackLimiter allows everything.
+type trackLimiter struct {
+	slots chan struct{}
+}
+
+func newTrackLimiter(maxConcurrentTracks int) *trackLimiter {
+	if maxConcurrentTracks <= 0 {
+		return nil
+	}
+
+	return &trackLimiter{
+		slots: make(chan struct{}, maxConcurrentTracks),
+	}
+}
+
+// TryAcquire takes a slot without waiting, reporting whether one was free.
+// Every successful call must be paired with Release.
+func (l *trackLimiter) TryAcquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *trackLimiter) Release() {
+	if l == nil {
+		return
+	}
+
+	<-l.slots
+}
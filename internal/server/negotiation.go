@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	formatPkg "github.com/jorgejr568/wheregoes/internal/format"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/echo/v4"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// trackFormat is a representation of a /tracks response, picked from the
+// request's Accept header.
+type trackFormat string
+
+const (
+	// trackFormatJSON answers the whole chain as a single JSON document once
+	// it finishes.
+	trackFormatJSON trackFormat = echo.MIMEApplicationJSON
+	// trackFormatNDJSON streams a JSON line per checkpoint as it's recorded,
+	// then a finish or error line, like the websocket messages.
+	trackFormatNDJSON trackFormat = "application/x-ndjson"
+	// trackFormatText streams the hops in the CLI's human-readable format.
+	trackFormatText trackFormat = echo.MIMETextPlain
+)
+
+var trackFormats = []trackFormat{trackFormatJSON, trackFormatNDJSON, trackFormatText}
+
+// negotiateTrackFormat returns the format of accept's most preferred media
+// type that /tracks can answer with, JSON when none is.
+func negotiateTrackFormat(accept string) trackFormat {
+	best, bestQuality := trackFormatJSON, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		for _, format := range trackFormats {
+			if mediaType == string(format) {
+				best, bestQuality = format, quality
+				break
+			}
+		}
+		if mediaType == "*/*" || mediaType == "application/*" {
+			best, bestQuality = trackFormatJSON, quality
+		}
+	}
+
+	return best
+}
+
+// respondTrackStream answers with the track of url in format, a streaming
+// one, writing each hop as soon as it's recorded. Errors ending the track
+// before any hop was written keep their HTTP status; later ones end the
+// stream with a 200 already sent. Tracks are recorded to auditLog.
+func respondTrackStream(c echo.Context, format trackFormat, url string, trackCh <-chan wheregoes.TrackChannelResponse, auditLog *trackLog) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, string(format)+"; charset=utf-8")
+	res.Header().Set(echo.HeaderXContentTypeOptions, "nosniff")
+
+	writeLine := func(line any) error {
+		var err error
+		if format == trackFormatText {
+			_, err = fmt.Fprintln(res, line)
+		} else {
+			err = json.NewEncoder(res).Encode(line)
+		}
+		res.Flush()
+		return err
+	}
+
+	hops := 0
+	for response := range trackCh {
+		switch {
+		case response.Err != nil:
+			auditLog.Record(c, url, nil, response.Err)
+			errorResponse := newTrackErrorResponse(response.Err)
+			if errorResponse.Code == errorCodeInternal {
+				c.Logger().Errorf("[%s] Error tracking %s: %v", requestIDOf(c), url, response.Err)
+			}
+			if hops == 0 {
+				res.WriteHeader(errorResponse.Code.httpStatus())
+			}
+			if format == trackFormatText {
+				return writeLine("Error: " + errorResponse.Error)
+			}
+			return writeLine(errorResponse)
+		case response.Finished:
+			auditLog.Record(c, url, response.Response, nil)
+			c.Logger().Infof("[%s] Finished tracking of %s", requestIDOf(c), url)
+			if format == trackFormatText {
+				for _, detail := range formatPkg.Details(response.Response) {
+					if err := writeLine(detail); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			return writeLine(newTrackFinishResponse())
+		default:
+			hops++
+			if format == trackFormatText {
+				if err := writeLine(formatPkg.Hop(hops, response.Checkpoint)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeLine(trackCheckpointMessage{TrackCheckpoint: response.Checkpoint}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The channel closes without a last message when the server shuts down.
+	return nil
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// openAPISchemas are the types documented under components.schemas, generated
+// from the types the handlers encode and decode.
+var openAPISchemas = map[string]any{
+	"TrackRequest":    trackRequest{},
+	"TrackResponse":   wheregoes.TrackResponse{},
+	"TrackCheckpoint": trackCheckpointMessage{},
+	"TrackError":      trackErrorResponse{},
+	"TrackFinish":     trackFinishResponse{},
+	"TrackDone":       trackDoneResponse{},
+	"VerifyRequest":   verifyRequest{},
+	"VerifyResponse":  verifyResponse{},
+}
+
+var errorCodes = []errorCode{
+	errorCodeCircularRedirect,
+	errorCodeTooManyRedirects,
+	errorCodeTimeout,
+	errorCodeOverBudget,
+	errorCodeNetwork,
+	errorCodeInvalidUrl,
+	errorCodeInvalidRequest,
+	errorCodeServerBusy,
+	errorCodeInternal,
+}
+
+// openAPIDocument returns the OpenAPI 3 description of the server, served at
+// /openapi.json.
+func openAPIDocument() ([]byte, error) {
+	schemas := map[string]any{}
+	for name, value := range openAPISchemas {
+		schemas[name] = jsonSchemaOf(reflect.TypeOf(value))
+	}
+
+	errorSchema := schemas["TrackError"].(map[string]any)
+	errorSchema["properties"].(map[string]any)["code"] = map[string]any{
+		"type": "string",
+		"enum": errorCodes,
+	}
+
+	errorResponse := map[string]any{
+		"description": "The track failed, see code.",
+		"content":     jsonContent("TrackError"),
+	}
+
+	return json.Marshal(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "wheregoes",
+			"version": "1.0.0",
+		},
+		"paths": map[string]any{
+			"/tracks": map[string]any{
+				"post": map[string]any{
+					"summary": "Track where a url redirects to",
+					"description": "Answers the whole chain as JSON once it finishes, unless the Accept header " +
+						"prefers a streaming format: application/x-ndjson writes a TrackCheckpoint line per hop " +
+						"as it's recorded, then a TrackFinish or TrackError line, and text/plain writes the " +
+						"hops as the CLI prints them. An error after the first hop ends the stream instead of " +
+						"changing the status.",
+					"requestBody": map[string]any{
+						"required": true,
+						"content":  jsonContent("TrackRequest"),
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The whole redirect chain.",
+							"content":     trackContent(),
+						},
+						"400": errorResponse,
+						"409": errorResponse,
+						"502": errorResponse,
+						"503": errorResponse,
+						"504": errorResponse,
+					},
+				},
+			},
+			"/tracks/verify": map[string]any{
+				"post": map[string]any{
+					"summary": "Check a url's redirect chain against the expected one",
+					"description": "Tracks url and compares the chain with the expected final url, registrable " +
+						"domains visited and hop count, only for the fields set. The diff lists the fields " +
+						"that didn't match.",
+					"requestBody": map[string]any{
+						"required": true,
+						"content":  jsonContent("VerifyRequest"),
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Whether the chain matched.",
+							"content":     jsonContent("VerifyResponse"),
+						},
+						"400": errorResponse,
+						"409": errorResponse,
+						"502": errorResponse,
+						"503": errorResponse,
+						"504": errorResponse,
+					},
+				},
+			},
+			"/tracksWs": map[string]any{
+				"get": map[string]any{
+					"summary": "Track urls over a websocket",
+					"description": "Each TrackRequest message sent starts a track. The server answers with a " +
+						"TrackCheckpoint message per hop, then a TrackFinish message, or a TrackError message " +
+						"if the track fails. A TrackRequest with urls tracks them concurrently: messages carry " +
+						"the trackId of their url, the index in urls, and a TrackDone message follows them all. " +
+						"Tracks following more redirects than the server allows websockets fail with a " +
+						"TOO_MANY_REDIRECTS TrackError, and the connection keeps accepting requests.",
+					"responses": map[string]any{
+						"101": map[string]any{
+							"description": "Switching to the websocket protocol.",
+						},
+					},
+				},
+			},
+		},
+		"components": map[string]any{
+			"schemas": schemas,
+		},
+	})
+}
+
+func jsonContent(schema string) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{
+			"schema": map[string]any{"$ref": "#/components/schemas/" + schema},
+		},
+	}
+}
+
+// trackContent lists the representations /tracks negotiates.
+func trackContent() map[string]any {
+	content := jsonContent("TrackResponse")
+	content[string(trackFormatNDJSON)] = map[string]any{
+		"schema": map[string]any{"type": "string"},
+	}
+	content[string(trackFormatText)] = map[string]any{
+		"schema": map[string]any{"type": "string"},
+	}
+	return content
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	headersType  = reflect.TypeOf(wheregoes.Headers{})
+)
+
+// jsonSchemaOf describes how encoding/json encodes values of type t, with
+// the fields of embedded structs inlined.
+func jsonSchemaOf(t reflect.Type) map[string]any {
+	if t == durationType {
+		return map[string]any{"type": "integer", "description": "Duration in nanoseconds."}
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t == headersType {
+		return map[string]any{
+			"type":        "object",
+			"description": "Headers by lowercased name, a string when sent once and an array of strings otherwise.",
+			"additionalProperties": map[string]any{
+				"oneOf": []any{
+					map[string]any{"type": "string"},
+					map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		addStructFields(t, properties, &required)
+
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]any{}
+	}
+}
+
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(embedded, properties, required)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = jsonSchemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
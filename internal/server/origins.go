@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originPolicy decides which browser origins may call the API, both through
+// CORS on /tracks and when upgrading /tracksWs.
+type originPolicy struct {
+	origins []string
+}
+
+// newOriginPolicy trims the configured origins and drops empty ones, so a
+// "https://a.com, https://b.com" list works as expected. Malformed origins
+// could never match and are dropped with a warning.
+func newOriginPolicy(origins []string) originPolicy {
+	policy := originPolicy{}
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			log.Printf("Ignoring allowed origin %q: %v", origin, err)
+			continue
+		}
+
+		policy.origins = append(policy.origins, normalized)
+	}
+	return policy
+}
+
+// normalizeOrigin validates a configured origin, which must be "*" or a
+// scheme and host like the Origin header browsers send, and lowercases it. The
+// host may start with a "*." wildcard label.
+func normalizeOrigin(origin string) (string, error) {
+	if origin == "*" {
+		return origin, nil
+	}
+
+	parsedOrigin, err := url.Parse(origin)
+	if err != nil {
+		return "", err
+	}
+
+	if parsedOrigin.Scheme == "" || parsedOrigin.Host == "" {
+		return "", fmt.Errorf("expected a scheme and host like https://example.com")
+	}
+
+	if strings.Contains(strings.TrimPrefix(parsedOrigin.Host, "*."), "*") {
+		return "", fmt.Errorf("only a leading *. wildcard is supported in hosts")
+	}
+
+	if strings.TrimSuffix(parsedOrigin.Path, "/") != "" || parsedOrigin.RawQuery != "" || parsedOrigin.Fragment != "" {
+		return "", fmt.Errorf("origins can't have a path, query or fragment")
+	}
+
+	return strings.ToLower(parsedOrigin.Scheme + "://" + parsedOrigin.Host), nil
+}
+
+// Enabled reports whether any origin was configured. Without one, CORS stays
+// off and websockets only accept same-origin requests.
+func (p originPolicy) Enabled() bool {
+	return len(p.origins) > 0
+}
+
+// Allows reports whether origin matches one of the configured origins, or
+// any origin when "*" is configured. An origin like "https://*.example.com"
+// matches every subdomain of example.com over https, but not example.com
+// itself.
+func (p originPolicy) Allows(origin string) bool {
+	for _, allowed := range p.origins {
+		if allowed == "*" || allowed == origin || matchesWildcardOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesWildcardOrigin(pattern string, origin string) bool {
+	if !strings.Contains(pattern, "://*.") {
+		return false
+	}
+
+	parsedPattern, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+
+	parsedOrigin, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if parsedOrigin.Scheme != parsedPattern.Scheme || parsedOrigin.Port() != parsedPattern.Port() {
+		return false
+	}
+
+	suffix := strings.TrimPrefix(parsedPattern.Hostname(), "*")
+	hostname := parsedOrigin.Hostname()
+	return len(hostname) > len(suffix) && strings.HasSuffix(hostname, suffix)
+}
+
+// checkOrigin is a websocket.Upgrader CheckOrigin. Requests without an Origin
+// header don't come from browsers and are always accepted.
+func (p originPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || p.Allows(origin)
+}
+
+// corsList trims the configured CORS methods or headers and drops empty ones,
+// falling back to def when none are left.
+func corsList(values []string, def []string) []string {
+	var list []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+
+	if len(list) == 0 {
+		return def
+	}
+	return list
+}
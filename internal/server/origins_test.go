@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewOriginPolicyTrimsEntries(t *testing.T) {
+	// As ALLOWED_ORIGINS is split.
+	policy := newOriginPolicy(strings.Split("https://a.com, https://b.com,, ,not an origin", ","))
+
+	if len(policy.origins) != 2 {
+		t.Fatalf("origins = %q, want the two valid ones", policy.origins)
+	}
+	for _, origin := range []string{"https://a.com", "https://b.com"} {
+		if !policy.Allows(origin) {
+			t.Errorf("Allows(%q) = false, want true", origin)
+		}
+	}
+}
+
+func TestNewOriginPolicyWithoutOrigins(t *testing.T) {
+	for _, origins := range [][]string{nil, {"", " "}} {
+		if policy := newOriginPolicy(origins); policy.Enabled() {
+			t.Errorf("newOriginPolicy(%q).Enabled() = true, want false", origins)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		allowed string
+		origin  string
+		want    bool
+	}{
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://evil.com", false},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://example.com.evil.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://app.example.com", false},
+		{"https://example.com", "http://example.com", false},
+		{"*", "https://anything.test", true},
+		{"https://example.com", "", true},
+	}
+	for _, test := range tests {
+		policy := newOriginPolicy([]string{test.allowed})
+		request := httptest.NewRequest(http.MethodGet, "/tracksWs", nil)
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		if got := policy.checkOrigin(request); got != test.want {
+			t.Errorf("checkOrigin(%q) with %q allowed = %t, want %t", test.origin, test.allowed, got, test.want)
+		}
+	}
+}
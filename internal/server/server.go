@@ -2,142 +2,548 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"github.com/gorilla/websocket"
-	"github.com/jorgejr568/wheregoes/internal/clients"
-	"github.com/jorgejr568/wheregoes/internal/services"
+	"github.com/jorgejr568/wheregoes/internal/pkg/pool"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var (
-	upgrader = websocket.Upgrader{}
-)
+const shutdownTimeout = 10 * time.Second
 
+// trackRequest tracks url, or over the websocket either url or every url of
+// urls at once.
 type trackRequest struct {
-	Url string `json:"url"`
+	Url  string   `json:"url"`
+	Urls []string `json:"urls,omitempty"`
 }
 
 type trackErrorResponse struct {
-	Error string `json:"error"`
+	Error string    `json:"error"`
+	Code  errorCode `json:"code"`
+	// TrackID is the index in the request's urls of the track the message
+	// belongs to, when several were requested at once.
+	TrackID *int `json:"trackId,omitempty"`
+	// Partial is the chain up to the hop going over a latency budget, for
+	// OVER_BUDGET errors answered as a whole rather than streamed.
+	Partial *wheregoes.TrackResponse `json:"partial,omitempty"`
 }
 
 type trackFinishResponse struct {
 	Finished bool `json:"finished"`
+	TrackID  *int `json:"trackId,omitempty"`
+}
+
+type trackCheckpointMessage struct {
+	TrackID *int `json:"trackId,omitempty"`
+	*wheregoes.TrackCheckpoint
+}
+
+// trackDoneResponse follows the finish or error messages of every track of a
+// urls request.
+type trackDoneResponse struct {
+	Done bool `json:"done"`
 }
 
 func newTrackErrorResponse(err error) trackErrorResponse {
-	return trackErrorResponse{Error: err.Error()}
+	return trackErrorResponse{Error: err.Error(), Code: errorCodeOf(err)}
 }
 
 func newTrackFinishResponse() trackFinishResponse {
 	return trackFinishResponse{Finished: true}
 }
 
-func Serve(ctx context.Context) error {
+func (r trackErrorResponse) withTrackID(trackID *int) trackErrorResponse {
+	r.TrackID = trackID
+	return r
+}
+
+func (r trackFinishResponse) withTrackID(trackID *int) trackFinishResponse {
+	r.TrackID = trackID
+	return r
+}
+
+// requestIDKey is where the request ID assigned by middleware.RequestID is
+// kept in the echo context.
+const requestIDKey = "requestID"
+
+// requestIDOf returns the request ID assigned by middleware.RequestID, used to
+// tag log lines so they can be correlated with the request ID header.
+func requestIDOf(c echo.Context) string {
+	requestID, _ := c.Get(requestIDKey).(string)
+	return requestID
+}
+
+// trackContext returns requestCtx, also cancelled once serverCtx is done, so
+// a track is stopped either when its client goes away or when the server
+// shuts down. cancel must be called once the track is done.
+func trackContext(requestCtx context.Context, serverCtx context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(requestCtx)
+	go func() {
+		select {
+		case <-serverCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// parseTrackUrl trims rawUrl and checks it's an http(s) url with a host,
+// failing with an error wrapping wheregoes.ErrInvalidUrl otherwise, so
+// malformed urls are answered with INVALID_URL before any hop is fetched
+// rather than failing like a network error.
+func parseTrackUrl(rawUrl string) (string, error) {
+	trackUrl := strings.TrimSpace(rawUrl)
+	if !utils.IsUrl(trackUrl) {
+		return "", wheregoes.ErrInvalidUrl
+	}
+
+	parsedUrl, err := url.Parse(trackUrl)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("%w, %q is malformed: %v", wheregoes.ErrInvalidUrl, trackUrl, err)
+	}
+	if parsedUrl.Host == "" {
+		return "", fmt.Errorf("%w, %q has no host", wheregoes.ErrInvalidUrl, trackUrl)
+	}
+	return trackUrl, nil
+}
+
+// respondBindError answers a request body that couldn't be bound with an
+// INVALID_REQUEST error, keeping the status picked by echo.
+func respondBindError(c echo.Context, err error) error {
+	status, message := http.StatusBadRequest, err.Error()
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status, message = httpErr.Code, fmt.Sprint(httpErr.Message)
+	}
+	return c.JSON(status, trackErrorResponse{Error: message, Code: errorCodeInvalidRequest})
+}
+
+// respondTrackError answers a request whose track of url failed with err,
+// along with the partial chain Track returned for partial chain errors,
+// leaving internal errors to echo's error handler once logged.
+func respondTrackError(c echo.Context, url string, partial wheregoes.TrackResponse, err error) error {
+	response := newTrackErrorResponse(err)
+	if wheregoes.IsPartialChainError(err) {
+		response.Partial = &partial
+	}
+	if response.Code == errorCodeInternal {
+		c.Logger().Errorf("[%s] Error tracking %s: %v", requestIDOf(c), url, err)
+		return err
+	}
+
+	return c.JSON(response.Code.httpStatus(), response)
+}
+
+// closeIdleConnections closes fetcher's idle connections every interval until
+// ctx is done.
+func closeIdleConnections(ctx context.Context, fetcher wheregoes.FetcherClient, interval time.Duration) {
+	closer, ok := fetcher.(interface{ CloseIdleConnections() })
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			closer.CloseIdleConnections()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func Serve(ctx context.Context, config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	address, err := config.Address()
+	if err != nil {
+		return err
+	}
+
+	var auditLog *trackLog
+	if config.TrackLogFile != "" {
+		if auditLog, err = openTrackLog(config.TrackLogFile, config.TrackLogMaxSize); err != nil {
+			return err
+		}
+		defer auditLog.Close()
+	}
+
 	echoServer := echo.New()
 	echoServer.HideBanner = true
+	websockets := newWsRegistry()
 	go func() {
 		<-ctx.Done()
 
 		log.Println("Shutting down server...")
-		if err := echoServer.Shutdown(ctx); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		websockets.CloseAll(shutdownCtx)
+		if err := echoServer.Shutdown(shutdownCtx); err != nil {
 			log.Fatal(err)
 		}
 	}()
 
-	service := services.NewTrackerService(clients.NewHttpFetcherClient())
+	requestIDHeader := config.RequestIDHeader
+	if requestIDHeader == "" {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+	echoServer.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		TargetHeader: requestIDHeader,
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			c.Set(requestIDKey, requestID)
+		},
+	}))
+
+	origins := newOriginPolicy(config.AllowedOrigins)
+	upgrader := websocket.Upgrader{}
+	if origins.Enabled() {
+		upgrader.CheckOrigin = origins.checkOrigin
+		echoServer.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOriginFunc: func(origin string) (bool, error) {
+				return origins.Allows(origin), nil
+			},
+			AllowMethods:     corsList(config.CORSAllowMethods, DefaultCORSAllowMethods),
+			AllowHeaders:     corsList(config.CORSAllowHeaders, append(append([]string{}, DefaultCORSAllowHeaders...), requestIDHeader)),
+			AllowCredentials: config.CORSAllowCredentials,
+			ExposeHeaders:    []string{requestIDHeader},
+			MaxAge:           int(config.CORSMaxAge / time.Second),
+		}))
+	}
+
+	var fetcherOpts []wheregoes.FetcherOption
+	if config.IdleConnTimeout > 0 {
+		fetcherOpts = append(fetcherOpts, wheregoes.WithIdleConnTimeout(config.IdleConnTimeout))
+	}
+	fetcher := wheregoes.NewHttpFetcherClient(fetcherOpts...)
+	cleanupInterval := config.IdleConnCleanupInterval
+	if cleanupInterval == 0 {
+		cleanupInterval = DefaultIdleConnCleanupInterval
+	}
+	go closeIdleConnections(ctx, fetcher, cleanupInterval)
+
+	service := wheregoes.NewTrackerService(
+		fetcher,
+		wheregoes.WithAllowedPorts(config.AllowedPorts),
+	)
+	wsMaxRedirects := config.WSMaxRedirects
+	if wsMaxRedirects == 0 {
+		wsMaxRedirects = DefaultWSMaxRedirects
+	}
+	wsService := wheregoes.NewTrackerService(
+		fetcher,
+		wheregoes.WithAllowedPorts(config.AllowedPorts),
+		wheregoes.WithMaxRedirects(wsMaxRedirects),
+	)
+	limiter := newTrackLimiter(config.MaxConcurrentTracks)
+	batchConcurrency := config.BatchConcurrency
+	if batchConcurrency == 0 {
+		batchConcurrency = DefaultBatchConcurrency
+	}
+
+	if config.GRPCPort != "" {
+		tracker := &grpcTracker{
+			ctx:             ctx,
+			service:         service,
+			limiter:         limiter,
+			auditLog:        auditLog,
+			requestIDHeader: requestIDHeader,
+		}
+		// The gRPC server also stops when the HTTP one fails, and running
+		// tracks get to send their last event before Serve returns.
+		grpcCtx, stopGRPC := context.WithCancel(ctx)
+		grpcDone := make(chan struct{})
+		go func() {
+			defer close(grpcDone)
+			if err := serveGRPC(grpcCtx, config, tracker); err != nil {
+				log.Println("gRPC server failed:", err)
+			}
+		}()
+		defer func() {
+			stopGRPC()
+			<-grpcDone
+		}()
+	}
+
+	openAPI, err := openAPIDocument()
+	if err != nil {
+		return err
+	}
+	echoServer.GET("/openapi.json", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, openAPI)
+	})
+
+	if config.ServeUI {
+		echoServer.GET("/", func(c echo.Context) error {
+			return c.HTMLBlob(http.StatusOK, uiPage)
+		})
+	}
+
+	if config.ServeMetrics {
+		echoServer.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
+	}
 
 	echoServer.POST("/tracks", func(c echo.Context) error {
 		request := new(trackRequest)
 		if err := c.Bind(request); err != nil {
-			return err
+			return respondBindError(c, err)
 		}
 
-		response, err := service.Track(ctx, request.Url)
+		trackUrl, err := parseTrackUrl(request.Url)
 		if err != nil {
-			if errors.Is(err, services.ErrCircularRedirection) {
-				return c.JSON(http.StatusConflict, newTrackErrorResponse(err))
-			}
+			return c.JSON(errorCodeInvalidUrl.httpStatus(), newTrackErrorResponse(err))
+		}
+		request.Url = trackUrl
 
-			return err
+		if !limiter.TryAcquire() {
+			c.Response().Header().Set(echo.HeaderRetryAfter, retryAfterSeconds)
+			response := newTrackErrorResponse(errServerBusy)
+			return c.JSON(response.Code.httpStatus(), response)
+		}
+		defer limiter.Release()
+
+		trackCtx, cancel := trackContext(c.Request().Context(), ctx)
+		defer cancel()
+
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		if format := negotiateTrackFormat(c.Request().Header.Get(echo.HeaderAccept)); format != trackFormatJSON {
+			return respondTrackStream(c, format, request.Url, service.TrackChannel(trackCtx, request.Url), auditLog)
 		}
 
+		response, err := service.Track(trackCtx, request.Url)
+		auditLog.Record(c, request.Url, &response, err)
+		if err != nil {
+			return respondTrackError(c, request.Url, response, err)
+		}
+
+		c.Logger().Infof("[%s] Finished tracking of %s", requestIDOf(c), request.Url)
 		return c.JSON(http.StatusOK, response)
 	})
 
+	echoServer.POST("/tracks/verify", func(c echo.Context) error {
+		request := new(verifyRequest)
+		if err := c.Bind(request); err != nil {
+			return respondBindError(c, err)
+		}
+
+		trackUrl, err := parseTrackUrl(request.Url)
+		if err != nil {
+			return c.JSON(errorCodeInvalidUrl.httpStatus(), newTrackErrorResponse(err))
+		}
+		request.Url = trackUrl
+
+		if !limiter.TryAcquire() {
+			c.Response().Header().Set(echo.HeaderRetryAfter, retryAfterSeconds)
+			response := newTrackErrorResponse(errServerBusy)
+			return c.JSON(response.Code.httpStatus(), response)
+		}
+		defer limiter.Release()
+
+		trackCtx, cancel := trackContext(c.Request().Context(), ctx)
+		defer cancel()
+
+		response, err := service.Track(trackCtx, request.Url)
+		auditLog.Record(c, request.Url, &response, err)
+		if err != nil {
+			return respondTrackError(c, request.Url, response, err)
+		}
+
+		verification := verifyTrack(request.Expected, response)
+		c.Logger().Infof("[%s] Verified %s, match: %t", requestIDOf(c), request.Url, verification.Match)
+		return c.JSON(http.StatusOK, verification)
+	})
+
 	echoServer.GET("/tracksWs", func(c echo.Context) error {
+		requestID := requestIDOf(c)
 		ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 		if err != nil {
 			return err
 		}
+		if !websockets.Add(ws) {
+			closeGoingAway(ws)
+			return ws.Close()
+		}
 		defer func() {
+			websockets.Remove(ws)
 			ws.Close()
 		}()
 
-	wsLoop:
-		for {
-			_, msg, err := ws.ReadMessage()
+		// connCtx stops the connection's tracks once its client is gone, so
+		// they don't hold limiter slots running to completion for nobody.
+		connCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var writeMu sync.Mutex
+		write := func(message any) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := ws.WriteJSON(message); err != nil {
+				c.Logger().Errorf("[%s] Error writing to websocket: %v", requestID, err)
+				cancel()
+			}
+		}
+
+		// streamTrack writes each checkpoint of the track of url as it's
+		// recorded, then a finish or error message. trackID tags the messages
+		// of tracks started together from a urls list.
+		streamTrack := func(url string, trackID *int) {
+			url, err := parseTrackUrl(url)
 			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-					c.Logger().Debug("Client closed connection")
-					return nil
-				}
-				c.Logger().Error(err)
-				return err
+				write(newTrackErrorResponse(err).withTrackID(trackID))
+				return
 			}
 
-			c.Logger().Info(fmt.Sprintf("Received message: %s", msg))
+			if !limiter.TryAcquire() {
+				write(newTrackErrorResponse(errServerBusy).withTrackID(trackID))
+				return
+			}
+			defer limiter.Release()
 
-			request := new(trackRequest)
-			if err = json.Unmarshal(msg, request); err != nil {
-				c.Logger().Error(err)
-				err = ws.WriteJSON(newTrackErrorResponse(err))
-				if err != nil {
-					c.Logger().Error("Error writing to websocket: ", err)
+			for response := range wsService.TrackChannel(connCtx, url) {
+				if response.Err != nil {
+					auditLog.Record(c, url, nil, response.Err)
+					write(newTrackErrorResponse(response.Err).withTrackID(trackID))
+					return
+				}
+
+				if response.Finished {
+					auditLog.Record(c, url, response.Response, nil)
+					write(newTrackFinishResponse().withTrackID(trackID))
+					c.Logger().Infof("[%s] Finished tracking of %s", requestID, url)
+					return
 				}
-				continue wsLoop
+
+				write(trackCheckpointMessage{TrackID: trackID, TrackCheckpoint: response.Checkpoint})
 			}
+			// The channel closes without a last message when connCtx is
+			// cancelled, as the client goes away or the server shuts down.
+		}
 
-			trackChannel := service.TrackChannel(ctx, request.Url)
+		// Messages are read on a goroutine of their own, so a client going
+		// away while a message's tracks run is noticed right away.
+		messages := make(chan []byte)
+		readErr := make(chan error, 1)
+		go func() {
 			for {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					readErr <- err
+					cancel()
+					return
+				}
 				select {
-				case response := <-trackChannel:
-					if response.Err != nil {
-						err = ws.WriteJSON(newTrackErrorResponse(response.Err))
-						if err != nil {
-							c.Logger().Error("Error writing to websocket: ", err)
-						}
-						continue wsLoop
-					}
-
-					if response.Finished {
-						err = ws.WriteJSON(newTrackFinishResponse())
-						if err != nil {
-							c.Logger().Error("Error writing to websocket: ", err)
-
-						}
-
-						c.Logger().Info("Finished tracking of", request.Url)
-						continue wsLoop
-					}
-
-					checkpoint := response.Checkpoint
-					err := ws.WriteJSON(checkpoint)
-					if err != nil {
-						c.Logger().Error("Error writing to websocket: ", err)
-					}
+				case messages <- msg:
+				case <-connCtx.Done():
+					return
 				}
 			}
-		}
+		}()
+
+		for {
+			var msg []byte
+			select {
+			case msg = <-messages:
+			case err := <-readErr:
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					c.Logger().Debugf("[%s] Client closed connection", requestID)
+					return nil
+				}
+				c.Logger().Errorf("[%s] %v", requestID, err)
+				return err
+			}
+
+			c.Logger().Infof("[%s] Received message: %s", requestID, msg)
+
+			request := new(trackRequest)
+			if err := json.Unmarshal(msg, request); err != nil {
+				c.Logger().Errorf("[%s] %v", requestID, err)
+				write(newTrackErrorResponse(err))
+				continue
+			}
+
+			if len(request.Urls) == 0 {
+				streamTrack(request.Url, nil)
+				continue
+			}
+
+			if len(request.Urls) > maxUrlsPerMessage {
+				write(newTrackErrorResponse(errTooManyUrls))
+				continue
+			}
 
-		return nil
+			pool.New(batchConcurrency, batchTracksInFlight).Run(len(request.Urls), func(i int) {
+				trackID := i
+				streamTrack(request.Urls[i], &trackID)
+			})
+			write(trackDoneResponse{Done: true})
+		}
 	})
 
-	err := echoServer.Start(":8080")
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	// With port 0 the OS picks the port, so report the one actually used.
+	config.Port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	if config.TLSEnabled() {
+		echoServer.TLSServer.TLSConfig, err = newTLSConfig(config)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		echoServer.TLSListener = tls.NewListener(listener, echoServer.TLSServer.TLSConfig)
+	} else {
+		echoServer.Listener = listener
+	}
+
+	log.Printf("Listening on %s", net.JoinHostPort(config.BindAddress, config.Port))
+	if config.PortFile != "" {
+		if err = os.WriteFile(config.PortFile, []byte(config.Port+"\n"), 0o644); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	echoServer.HidePort = true
+	if config.TLSEnabled() {
+		if config.HTTPRedirectPort != "" {
+			go func() {
+				if err := serveHTTPSRedirect(ctx, config); err != nil {
+					log.Println("HTTPS redirect server failed:", err)
+				}
+			}()
+		}
+
+		err = echoServer.StartServer(echoServer.TLSServer)
+	} else {
+		err = echoServer.Start(address)
+	}
+
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startServer serves config on a port picked by the OS until the test ends,
+// returning its address and a function shutting it down and returning Serve's
+// error, which can be called several times.
+func startServer(t *testing.T, config Config) (address string, shutdown func() error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config.BindAddress = "127.0.0.1"
+	config.Port = "0"
+	config.PortFile = filepath.Join(t.TempDir(), "port")
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, config)
+	}()
+
+	var (
+		once        sync.Once
+		shutdownErr error
+	)
+	shutdown = func() error {
+		once.Do(func() {
+			cancel()
+			select {
+			case shutdownErr = <-done:
+			case <-time.After(shutdownTimeout):
+				shutdownErr = errors.New("the server didn't shut down")
+			}
+		})
+		return shutdownErr
+	}
+	t.Cleanup(func() { _ = shutdown() })
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		select {
+		case err := <-done:
+			t.Fatalf("Serve() error = %v", err)
+		default:
+		}
+		if port, err := os.ReadFile(config.PortFile); err == nil && strings.HasSuffix(string(port), "\n") {
+			return net.JoinHostPort(config.BindAddress, strings.TrimSpace(string(port))), shutdown
+		}
+	}
+	t.Fatal("the server didn't start listening")
+	return "", nil
+}
+
+func TestTracksStopsWhenRequestCancelled(t *testing.T) {
+	blocked := make(chan struct{})
+	aborted := make(chan struct{})
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			// Hangs until the fetch is cancelled.
+			close(blocked)
+			<-r.Context().Done()
+			close(aborted)
+		}
+	}))
+	defer upstream.Close()
+
+	address, _ := startServer(t, DefaultConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+"/tracks",
+		strings.NewReader(`{"url": "`+upstream.URL+`/a"}`))
+	request.Header.Set("Content-Type", "application/json")
+	go func() {
+		if response, err := http.DefaultClient.Do(request); err == nil {
+			response.Body.Close()
+		}
+	}()
+
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the track never reached the blocking hop")
+	}
+	cancel()
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hop wasn't cancelled with the request")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := requests.Load(); got != 2 {
+		t.Errorf("upstream got %d requests, want none after the cancellation", got)
+	}
+}
+
+func TestTracksRejectsMalformedRequests(t *testing.T) {
+	address, _ := startServer(t, DefaultConfig())
+
+	tests := []struct {
+		name string
+		body string
+		code errorCode
+	}{
+		{"not a url", `{"url": "not a url"}`, errorCodeInvalidUrl},
+		{"malformed url", `{"url": "http://[::1"}`, errorCodeInvalidUrl},
+		{"unsupported scheme", `{"url": "ftp://example.com"}`, errorCodeInvalidUrl},
+		{"malformed body", `{"url": `, errorCodeInvalidRequest},
+		{"url of the wrong type", `{"url": 1}`, errorCodeInvalidRequest},
+	}
+	for _, path := range []string{"/tracks", "/tracks/verify"} {
+		for _, test := range tests {
+			t.Run(strings.TrimPrefix(path, "/")+" "+test.name, func(t *testing.T) {
+				response, err := http.Post("http://"+address+path, "application/json", strings.NewReader(test.body))
+				if err != nil {
+					t.Fatalf("Post() error = %v", err)
+				}
+				defer response.Body.Close()
+
+				if response.StatusCode != http.StatusBadRequest {
+					t.Errorf("status = %d, want %d", response.StatusCode, http.StatusBadRequest)
+				}
+				var body trackErrorResponse
+				if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+					t.Fatalf("the body isn't an error response: %v", err)
+				}
+				if body.Code != test.code || body.Error == "" {
+					t.Errorf("body = %+v, want a %s error", body, test.code)
+				}
+			})
+		}
+	}
+}
+
+func TestRespondTrackErrorWithPartialChain(t *testing.T) {
+	partial := wheregoes.TrackResponse{
+		Url: "https://example.com/b",
+		Checkpoints: []wheregoes.TrackCheckpoint{
+			{Url: "https://example.com/a", Status: http.StatusFound},
+			{Url: "https://example.com/b", Status: http.StatusFound, Slow: true},
+		},
+	}
+	err := fmt.Errorf("%w: hops took 120ms up to https://example.com/b, over 100ms", wheregoes.ErrChainOverBudget)
+
+	recorder := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/tracks", nil), recorder)
+	if err := respondTrackError(c, "https://example.com/a", partial, err); err != nil {
+		t.Fatalf("respondTrackError() error = %v", err)
+	}
+
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusGatewayTimeout)
+	}
+	var body trackErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("the body isn't an error response: %v", err)
+	}
+	if body.Code != errorCodeOverBudget || body.Partial == nil || len(body.Partial.Checkpoints) != 2 {
+		t.Errorf("body = %+v, want an %s error with the 2 hops of the partial chain", body, errorCodeOverBudget)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	for _, serveMetrics := range []bool{false, true} {
+		config := DefaultConfig()
+		config.ServeMetrics = serveMetrics
+		address, shutdown := startServer(t, config)
+
+		response, err := http.Get("http://" + address + "/debug/vars")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		var vars map[string]any
+		decodeErr := json.NewDecoder(response.Body).Decode(&vars)
+		response.Body.Close()
+
+		if !serveMetrics {
+			if response.StatusCode != http.StatusNotFound {
+				t.Errorf("without ServeMetrics, status = %d, want %d", response.StatusCode, http.StatusNotFound)
+			}
+		} else if decodeErr != nil {
+			t.Errorf("the metrics aren't JSON: %v", decodeErr)
+		} else if inFlight, ok := vars["batch_tracks_in_flight"]; !ok || inFlight != float64(0) {
+			t.Errorf("batch_tracks_in_flight = %v, want 0 while idle", inFlight)
+		}
+		if err := shutdown(); err != nil {
+			t.Fatalf("Serve() error = %v", err)
+		}
+	}
+}
+
+func TestTracksTextFormat(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+		}
+	}))
+	defer upstream.Close()
+	address, _ := startServer(t, DefaultConfig())
+
+	request, _ := http.NewRequest(http.MethodPost, "http://"+address+"/tracks", strings.NewReader(`{"url": "`+upstream.URL+`/a"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "text/plain")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want a line per hop", body)
+	}
+	for i, path := range []string{"/a", "/b"} {
+		prefix := fmt.Sprintf("%d ....... %s%s (", i+1, upstream.URL, path)
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want it formatted like the CLI, starting with %q", i+1, lines[i], prefix)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// newTLSConfig loads the configured certificate, offering HTTP/2 like echo's
+// StartTLS does.
+func newTLSConfig(config Config) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// serveHTTPSRedirect listens on the plain HTTP redirect port and sends every
+// request to the same host and path on the HTTPS port until ctx is done.
+func serveHTTPSRedirect(ctx context.Context, config Config) error {
+	address, err := config.redirectAddress()
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr: address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+
+			if config.Port != "443" {
+				host = net.JoinHostPort(host, config.Port)
+			}
+
+			target := url.URL{
+				Scheme:   "https",
+				Host:     host,
+				Path:     r.URL.Path,
+				RawQuery: r.URL.RawQuery,
+			}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down HTTPS redirect server:", err)
+		}
+	}()
+
+	log.Println("Redirecting HTTP on", address, "to HTTPS")
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package trackerpb holds the Tracker gRPC service generated from
+// tracker.proto. Regenerate it with go generate after editing the proto.
+package trackerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative tracker.proto
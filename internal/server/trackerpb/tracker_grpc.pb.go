@@ -0,0 +1,140 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: tracker.proto
+
+package trackerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Tracker_Track_FullMethodName = "/wheregoes.v1.Tracker/Track"
+)
+
+// TrackerClient is the client API for Tracker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TrackerClient interface {
+	// Track streams a Checkpoint event per hop of the request's url as it's
+	// recorded, then a Finish event, or an Error event if the track fails.
+	Track(ctx context.Context, in *TrackRequest, opts ...grpc.CallOption) (Tracker_TrackClient, error)
+}
+
+type trackerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrackerClient(cc grpc.ClientConnInterface) TrackerClient {
+	return &trackerClient{cc}
+}
+
+func (c *trackerClient) Track(ctx context.Context, in *TrackRequest, opts ...grpc.CallOption) (Tracker_TrackClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Tracker_ServiceDesc.Streams[0], Tracker_Track_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trackerTrackClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Tracker_TrackClient interface {
+	Recv() (*TrackEvent, error)
+	grpc.ClientStream
+}
+
+type trackerTrackClient struct {
+	grpc.ClientStream
+}
+
+func (x *trackerTrackClient) Recv() (*TrackEvent, error) {
+	m := new(TrackEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TrackerServer is the server API for Tracker service.
+// All implementations must embed UnimplementedTrackerServer
+// for forward compatibility
+type TrackerServer interface {
+	// Track streams a Checkpoint event per hop of the request's url as it's
+	// recorded, then a Finish event, or an Error event if the track fails.
+	Track(*TrackRequest, Tracker_TrackServer) error
+	mustEmbedUnimplementedTrackerServer()
+}
+
+// UnimplementedTrackerServer must be embedded to have forward compatible implementations.
+type UnimplementedTrackerServer struct {
+}
+
+func (UnimplementedTrackerServer) Track(*TrackRequest, Tracker_TrackServer) error {
+	return status.Errorf(codes.Unimplemented, "method Track not implemented")
+}
+func (UnimplementedTrackerServer) mustEmbedUnimplementedTrackerServer() {}
+
+// UnsafeTrackerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrackerServer will
+// result in compilation errors.
+type UnsafeTrackerServer interface {
+	mustEmbedUnimplementedTrackerServer()
+}
+
+func RegisterTrackerServer(s grpc.ServiceRegistrar, srv TrackerServer) {
+	s.RegisterService(&Tracker_ServiceDesc, srv)
+}
+
+func _Tracker_Track_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TrackRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrackerServer).Track(m, &trackerTrackServer{stream})
+}
+
+type Tracker_TrackServer interface {
+	Send(*TrackEvent) error
+	grpc.ServerStream
+}
+
+type trackerTrackServer struct {
+	grpc.ServerStream
+}
+
+func (x *trackerTrackServer) Send(m *TrackEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Tracker_ServiceDesc is the grpc.ServiceDesc for Tracker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tracker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wheregoes.v1.Tracker",
+	HandlerType: (*TrackerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Track",
+			Handler:       _Tracker_Track_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tracker.proto",
+}
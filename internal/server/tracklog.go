@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"github.com/labstack/echo/v4"
+	"os"
+	"sync"
+	"time"
+)
+
+// trackLogEntry is the line appended to the track log for each track, once
+// it finishes or fails.
+type trackLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	ClientIP  string    `json:"clientIp"`
+	RequestID string    `json:"requestId,omitempty"`
+	Url       string    `json:"url"`
+	FinalUrl  string    `json:"finalUrl,omitempty"`
+	Hops      int       `json:"hops,omitempty"`
+	// Status is the final hop's HTTP status.
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Code   errorCode `json:"code,omitempty"`
+}
+
+// trackLog appends a JSON line per track to a file, as a grep-able audit
+// trail. When the file would grow past maxSize, it's renamed with a ".1"
+// suffix, replacing the previous one, and a new file is started. A nil
+// trackLog records nothing.
+type trackLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// openTrackLog opens the track log at path for appending. maxSize 0 never
+// rotates it.
+func openTrackLog(path string, maxSize int64) (*trackLog, error) {
+	l := &trackLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *trackLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Record appends the outcome of the track of url requested through c: its
+// response, or err when it failed. Write errors are logged, so they never fail
+// the request.
+func (l *trackLog) Record(c echo.Context, url string, response *wheregoes.TrackResponse, err error) {
+	if err := l.record(c.RealIP(), requestIDOf(c), url, response, err); err != nil {
+		c.Logger().Errorf("[%s] Error writing the track log: %v", requestIDOf(c), err)
+	}
+}
+
+// record appends the outcome of the track of url requested by clientIP, for
+// requests outside echo, returning write errors.
+func (l *trackLog) record(clientIP string, requestID string, url string, response *wheregoes.TrackResponse, trackErr error) error {
+	if l == nil {
+		return nil
+	}
+
+	entry := trackLogEntry{
+		Timestamp: time.Now().UTC(),
+		ClientIP:  clientIP,
+		RequestID: requestID,
+		Url:       url,
+	}
+	if trackErr != nil {
+		errorResponse := newTrackErrorResponse(trackErr)
+		entry.Error, entry.Code = errorResponse.Error, errorResponse.Code
+	} else if response != nil {
+		entry.FinalUrl = response.Url
+		entry.Hops = response.HopCount()
+		if len(response.Checkpoints) > 0 {
+			entry.Status = response.Checkpoints[len(response.Checkpoints)-1].Status
+		}
+	}
+
+	return l.append(entry)
+}
+
+func (l *trackLog) append(entry trackLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rotateErr error
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		rotateErr = l.rotate()
+	}
+
+	// A failed rotation leaves the current file open, so the entry is still
+	// kept.
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return errors.Join(rotateErr, err)
+}
+
+func (l *trackLog) rotate() error {
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+
+	// The open file moved along with its path, so it's only swapped once the
+	// new one is open.
+	file := l.file
+	if err := l.open(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Close closes the log file.
+func (l *trackLog) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
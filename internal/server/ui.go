@@ -0,0 +1,11 @@
+package server
+
+import (
+	_ "embed"
+)
+
+// uiPage is the web page served at / with Config.ServeUI. It tracks urls over
+// the websocket and draws each hop as it resolves, with no dependencies.
+//
+//go:embed ui/index.html
+var uiPage []byte
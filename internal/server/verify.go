@@ -0,0 +1,89 @@
+package server
+
+import (
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"github.com/jorgejr568/wheregoes/pkg/wheregoes"
+	"reflect"
+)
+
+// verifyRequest tracks url and compares the chain with what's expected, to
+// guard links against regressions.
+type verifyRequest struct {
+	Url      string         `json:"url"`
+	Expected verifyExpected `json:"expected"`
+}
+
+// verifyExpected describes the expected chain. Only the fields set are
+// compared.
+type verifyExpected struct {
+	FinalUrl string `json:"finalUrl,omitempty"`
+	// Domains are the registrable domains the chain visits, in order and
+	// without duplicates.
+	Domains  []string `json:"domains,omitempty"`
+	HopCount *int     `json:"hopCount,omitempty"`
+}
+
+type verifyResponse struct {
+	Match bool `json:"match"`
+	// Diff holds the expected fields the chain didn't match.
+	Diff *verifyDiff `json:"diff,omitempty"`
+}
+
+type verifyDiff struct {
+	FinalUrl *verifyValueDiff `json:"finalUrl,omitempty"`
+	Domains  *verifyValueDiff `json:"domains,omitempty"`
+	HopCount *verifyValueDiff `json:"hopCount,omitempty"`
+}
+
+type verifyValueDiff struct {
+	Expected any `json:"expected"`
+	Actual   any `json:"actual"`
+}
+
+// verifyTrack compares response with expected.
+func verifyTrack(expected verifyExpected, response wheregoes.TrackResponse) verifyResponse {
+	diff := verifyDiff{}
+	match := true
+
+	if expected.FinalUrl != "" {
+		if utils.NormalizeUrl(expected.FinalUrl, false) != utils.NormalizeUrl(response.Url, false) {
+			diff.FinalUrl = &verifyValueDiff{Expected: expected.FinalUrl, Actual: response.Url}
+			match = false
+		}
+	}
+
+	if expected.Domains != nil {
+		domains := chainDomains(response.Checkpoints)
+		if !reflect.DeepEqual(expected.Domains, domains) {
+			diff.Domains = &verifyValueDiff{Expected: expected.Domains, Actual: domains}
+			match = false
+		}
+	}
+
+	if expected.HopCount != nil && *expected.HopCount != response.HopCount() {
+		diff.HopCount = &verifyValueDiff{Expected: *expected.HopCount, Actual: response.HopCount()}
+		match = false
+	}
+
+	if match {
+		return verifyResponse{Match: true}
+	}
+	return verifyResponse{Match: false, Diff: &diff}
+}
+
+// chainDomains returns the registrable domains of the hops, in order and
+// without duplicates.
+func chainDomains(checkpoints []wheregoes.TrackCheckpoint) []string {
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, checkpoint := range checkpoints {
+		domain := utils.RegistrableDomain(checkpoint.Url)
+		if domain == "" || seen[domain] {
+			continue
+		}
+
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+// maxUrlsPerMessage caps the urls of a single websocket message, of which at
+// most Config.BatchConcurrency are tracked at once.
+const maxUrlsPerMessage = 20
+
+// batchTracksInFlight is the number of tracks of websocket urls messages
+// running at once across the server, served at /debug/vars with
+// Config.ServeMetrics.
+var batchTracksInFlight = expvar.NewInt("batch_tracks_in_flight")
+
+var errTooManyUrls = fmt.Errorf("too many urls in a single message, at most %d are accepted", maxUrlsPerMessage)
+
+// closeWriteTimeout bounds how long sending a close frame to a client can take.
+const closeWriteTimeout = time.Second
+
+// wsRegistry tracks open websocket connections, so they can be closed cleanly
+// on shutdown instead of being reset once the process exits.
+type wsRegistry struct {
+	mu      sync.Mutex
+	conns   map[*websocket.Conn]struct{}
+	handled sync.WaitGroup
+	// draining is set once CloseAll starts, after which connections are
+	// refused, as CloseAll may already be waiting on handled.
+	draining bool
+}
+
+func newWsRegistry() *wsRegistry {
+	return &wsRegistry{
+		conns: map[*websocket.Conn]struct{}{},
+	}
+}
+
+// Add registers ws until Remove is called with it, once its handler is done.
+// It returns false, without registering ws, once the server is shutting down.
+func (r *wsRegistry) Add(ws *websocket.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return false
+	}
+
+	r.conns[ws] = struct{}{}
+	r.handled.Add(1)
+	return true
+}
+
+func (r *wsRegistry) Remove(ws *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[ws]; !ok {
+		return
+	}
+
+	delete(r.conns, ws)
+	r.handled.Done()
+}
+
+// CloseAll sends every connection a going-away close frame and waits for their
+// handlers to finish, which happens once clients acknowledge the close. The
+// connections still open when ctx is done are closed abruptly.
+func (r *wsRegistry) CloseAll(ctx context.Context) {
+	r.mu.Lock()
+	r.draining = true
+	for ws := range r.conns {
+		closeGoingAway(ws)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.handled.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for ws := range r.conns {
+			_ = ws.Close()
+		}
+	}
+}
+
+// closeGoingAway sends ws a going-away close frame, telling its client the
+// server is shutting down.
+func closeGoingAway(ws *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	_ = ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout))
+}
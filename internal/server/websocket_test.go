@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketClosedOnShutdown(t *testing.T) {
+	address, shutdown := startServer(t, DefaultConfig())
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/tracksWs", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer ws.Close()
+
+	closed := make(chan error, 1)
+	go func() {
+		_, _, err := ws.ReadMessage()
+		closed <- err
+	}()
+
+	if err := shutdown(); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	select {
+	case err := <-closed:
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("ReadMessage() error = %v, want a going-away close", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client wasn't sent a close frame")
+	}
+}
+
+func TestWsRegistryRefusesConnectionsWhileDraining(t *testing.T) {
+	registry := newWsRegistry()
+	registry.CloseAll(context.Background())
+
+	if registry.Add(&websocket.Conn{}) {
+		t.Error("Add() = true once draining, want false")
+	}
+}
+
+func TestWebsocketDisconnectReleasesLimiter(t *testing.T) {
+	blocked := make(chan struct{}, 1)
+	aborted := make(chan struct{}, 1)
+	testDone := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			// Hangs until the fetch is cancelled, or the test gives up.
+			blocked <- struct{}{}
+			select {
+			case <-r.Context().Done():
+				aborted <- struct{}{}
+			case <-testDone:
+			}
+		}
+	}))
+	defer upstream.Close()
+	defer close(testDone)
+
+	config := DefaultConfig()
+	config.MaxConcurrentTracks = 1
+	address, _ := startServer(t, config)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+address+"/tracksWs", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if err := ws.WriteJSON(trackRequest{Urls: []string{upstream.URL + "/hang"}}); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the track never reached the hanging hop")
+	}
+
+	// Drops the connection without a close frame, like a client going away.
+	ws.Close()
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the track kept running once its client was gone")
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		response, err := http.Post("http://"+address+"/tracks", "application/json", strings.NewReader(`{"url": "`+upstream.URL+`/ok"}`))
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode == http.StatusOK {
+			return
+		}
+		if response.StatusCode != http.StatusServiceUnavailable || time.Now().After(deadline) {
+			t.Fatalf("POST /tracks status = %d, want the limiter slot released", response.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	urlPkg "net/url"
+	"strings"
+)
+
+// AuthForwarding decides which hops the WithBasicAuth credentials are sent
+// to besides the first one.
+type AuthForwarding string
+
+const (
+	// AuthForwardingSameHost sends them to hops on the first hop's host and
+	// port, unless the hop downgrades https to http. It's the default.
+	AuthForwardingSameHost AuthForwarding = "same-host"
+	// AuthForwardingNever sends them with the first hop only.
+	AuthForwardingNever AuthForwarding = "never"
+	// AuthForwardingAlways sends them to every hop, whatever its host.
+	AuthForwardingAlways AuthForwarding = "always"
+)
+
+// ParseAuthForwarding parses "same-host", "never" or "always".
+func ParseAuthForwarding(value string) (AuthForwarding, error) {
+	switch forwarding := AuthForwarding(value); forwarding {
+	case AuthForwardingSameHost, AuthForwardingNever, AuthForwardingAlways:
+		return forwarding, nil
+	default:
+		return "", fmt.Errorf("invalid auth forwarding %q: expected same-host, never or always", value)
+	}
+}
+
+// WithBasicAuth sends username and password as an Authorization: Basic
+// header with the first hop, and with the redirects forwarding allows. An
+// empty forwarding means AuthForwardingSameHost.
+func WithBasicAuth(username string, password string, forwarding AuthForwarding) TrackerOption {
+	return func(config *trackerConfig) {
+		config.basicAuth = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		config.authForwarding = forwarding
+	}
+}
+
+// authorize returns headers with the WithBasicAuth Authorization header
+// added when it's to be sent to url, the chain having started at initialUrl.
+// headers is never modified.
+func (t *defaultTrackerService) authorize(headers http.Header, initialUrl string, url string) http.Header {
+	if t.config.basicAuth == "" || !t.config.authForwarding.allows(initialUrl, url) {
+		return headers
+	}
+
+	authorized := headers.Clone()
+	if authorized == nil {
+		authorized = http.Header{}
+	}
+	authorized.Set("Authorization", t.config.basicAuth)
+	return authorized
+}
+
+func (f AuthForwarding) allows(initialUrl string, url string) bool {
+	if url == initialUrl {
+		return true
+	}
+
+	switch f {
+	case AuthForwardingAlways:
+		return true
+	case AuthForwardingNever:
+		return false
+	}
+
+	parsedInitialUrl, err := urlPkg.Parse(initialUrl)
+	if err != nil {
+		return false
+	}
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return false
+	}
+
+	downgrade := parsedInitialUrl.Scheme == "https" && parsedUrl.Scheme != "https"
+	return strings.EqualFold(parsedInitialUrl.Host, parsedUrl.Host) && !downgrade
+}
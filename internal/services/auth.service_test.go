@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"net/http"
+	"testing"
+)
+
+func TestWithBasicAuth(t *testing.T) {
+	responses := map[string]clients.FetcherResponse{
+		"https://a.com/start":    redirect(http.StatusFound, "/next"),
+		"https://a.com/next":     redirect(http.StatusFound, "https://b.com/other"),
+		"https://b.com/other":    redirect(http.StatusFound, "http://a.com/downgrade"),
+		"http://a.com/downgrade": okResponse,
+	}
+	const authorization = "Basic YWxpY2U6czNjcmV0" // alice:s3cret
+
+	tests := []struct {
+		forwarding AuthForwarding
+		// authorized tells which of the four hops get the header.
+		authorized [4]bool
+	}{
+		{"", [4]bool{true, true, false, false}},
+		{AuthForwardingSameHost, [4]bool{true, true, false, false}},
+		{AuthForwardingNever, [4]bool{true, false, false, false}},
+		{AuthForwardingAlways, [4]bool{true, true, true, true}},
+	}
+	for _, test := range tests {
+		name := string(test.forwarding)
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			fetcher := &recordingFetcher{fetcher: routes(responses)}
+			service := NewTrackerService(fetcher, WithBasicAuth("alice", "s3cret", test.forwarding))
+			if _, err := service.Track(context.Background(), "https://a.com/start"); err != nil {
+				t.Fatalf("Track() error = %v", err)
+			}
+
+			if len(fetcher.requests) != 4 {
+				t.Fatalf("fetched %v, want 4 hops", fetcher.fetchedUrls())
+			}
+			for i, request := range fetcher.requests {
+				want := ""
+				if test.authorized[i] {
+					want = authorization
+				}
+				if got := request.Headers.Get("Authorization"); got != want {
+					t.Errorf("%s got Authorization %q, want %q", request.Url, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithoutBasicAuth(t *testing.T) {
+	fetcher := &recordingFetcher{fetcher: okFetcher()}
+	if _, err := NewTrackerService(fetcher).Track(context.Background(), "https://a.com"); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if got := fetcher.requests[0].Headers.Get("Authorization"); got != "" {
+		t.Errorf("sent Authorization %q without WithBasicAuth", got)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+)
+
+// chainLog collects a track's checkpoints as they're emitted. When compacted
+// with WithCompactChain, only the first keepFirst and the last keepLast are
+// kept, so chains of any length take bounded memory, and the ones in between
+// are only counted. ReturnsToOrigin is worked out as checkpoints come, so it
+// still accounts for the dropped ones.
+type chainLog struct {
+	compact   bool
+	keepFirst int
+	keepLast  int
+
+	first []TrackCheckpoint
+	// last is a ring of the latest checkpoints, next being the index of the
+	// oldest once it's full.
+	last   []TrackCheckpoint
+	next   int
+	elided int
+	hops   int
+
+	origin          string
+	leftOrigin      bool
+	returnsToOrigin bool
+}
+
+func (t *defaultTrackerService) newChainLog() *chainLog {
+	return &chainLog{
+		compact:   t.config.compactChain,
+		keepFirst: t.config.compactKeepFirst,
+		keepLast:  t.config.compactKeepLast,
+		first:     make([]TrackCheckpoint, 0, checkpointsCapacity),
+	}
+}
+
+func (l *chainLog) add(checkpoint TrackCheckpoint) {
+	l.trackOrigin(checkpoint.Url)
+	l.hops++
+
+	if !l.compact || len(l.first) < l.keepFirst {
+		l.first = append(l.first, checkpoint)
+		return
+	}
+	if len(l.last) < l.keepLast {
+		l.last = append(l.last, checkpoint)
+		return
+	}
+
+	l.last[l.next] = checkpoint
+	l.next = (l.next + 1) % l.keepLast
+	l.elided++
+}
+
+func (l *chainLog) trackOrigin(url string) {
+	domain := utils.RegistrableDomain(url)
+	switch {
+	case l.hops == 0:
+		l.origin = domain
+	case l.origin == "":
+	case domain != l.origin:
+		l.leftOrigin = true
+	case l.leftOrigin:
+		l.returnsToOrigin = true
+	}
+}
+
+// checkpoints returns the checkpoints kept, in chain order, with a checkpoint
+// standing for the elided ones between the first and the last.
+func (l *chainLog) checkpoints() []TrackCheckpoint {
+	if l.elided == 0 && len(l.last) == 0 {
+		return l.first
+	}
+
+	checkpoints := make([]TrackCheckpoint, 0, len(l.first)+1+len(l.last))
+	checkpoints = append(checkpoints, l.first...)
+	if l.elided > 0 {
+		note := fmt.Sprintf("%d hops elided", l.elided)
+		if l.elided == 1 {
+			note = "1 hop elided"
+		}
+		checkpoints = append(checkpoints, TrackCheckpoint{Note: note, Elided: l.elided})
+	}
+	checkpoints = append(checkpoints, l.last[l.next:]...)
+	return append(checkpoints, l.last[:l.next]...)
+}
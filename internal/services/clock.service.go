@@ -0,0 +1,23 @@
+package services
+
+import "time"
+
+// Clock tells the time trackers measure latencies and timestamp checkpoints
+// with, so tests can control it and assert exact values.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock measures latencies and timestamps checkpoints with clock instead
+// of the system clock. Timeouts and delays still run on the system clock.
+func WithClock(clock Clock) TrackerOption {
+	return func(config *trackerConfig) {
+		config.clock = clock
+	}
+}
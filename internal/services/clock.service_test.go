@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithClockTwoHops(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	fetcher := latencyFetcher(clock, routes(map[string]clients.FetcherResponse{
+		"https://example.com/a": redirect(http.StatusMovedPermanently, "/b"),
+		"https://example.com/b": okResponse,
+	}), map[string]time.Duration{
+		"https://example.com/a": 120 * time.Millisecond,
+		"https://example.com/b": 30 * time.Millisecond,
+	})
+
+	response, err := NewTrackerService(fetcher, WithClock(clock), WithSlowThreshold(100*time.Millisecond)).
+		Track(context.Background(), "https://example.com/a")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if len(response.Checkpoints) != 2 {
+		t.Fatalf("got %d checkpoints, want 2", len(response.Checkpoints))
+	}
+
+	want := []struct {
+		latency   time.Duration
+		timestamp time.Time
+		slow      bool
+	}{
+		{120 * time.Millisecond, start.Add(120 * time.Millisecond), true},
+		{30 * time.Millisecond, start.Add(150 * time.Millisecond), false},
+	}
+	for i, checkpoint := range response.Checkpoints {
+		if checkpoint.Latency != want[i].latency {
+			t.Errorf("checkpoint %d Latency = %s, want %s", i, checkpoint.Latency, want[i].latency)
+		}
+		if !checkpoint.Timestamp.Equal(want[i].timestamp) {
+			t.Errorf("checkpoint %d Timestamp = %s, want %s", i, checkpoint.Timestamp, want[i].timestamp)
+		}
+		if checkpoint.Slow != want[i].slow {
+			t.Errorf("checkpoint %d Slow = %t, want %t", i, checkpoint.Slow, want[i].slow)
+		}
+	}
+}
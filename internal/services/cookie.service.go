@@ -0,0 +1,70 @@
+package services
+
+import (
+	"github.com/jorgejr568/wheregoes/internal/pkg/set"
+	"golang.org/x/net/publicsuffix"
+	"net/http"
+	"net/http/cookiejar"
+	urlPkg "net/url"
+)
+
+// cookieGate keeps the cookies of a single track and lets each url redirect
+// to itself once after setting cookies, see WithCookieGate. A nil cookieGate
+// keeps no cookies and allows no retries.
+type cookieGate struct {
+	jar     *cookiejar.Jar
+	retried set.Set[string]
+}
+
+func newCookieGate() *cookieGate {
+	// cookiejar.New only fails on invalid options.
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &cookieGate{
+		jar:     jar,
+		retried: set.New[string](),
+	}
+}
+
+// Cookies returns the cookies to send with a request to url.
+func (g *cookieGate) Cookies(url string) []*http.Cookie {
+	if g == nil {
+		return nil
+	}
+
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return nil
+	}
+	return g.jar.Cookies(parsedUrl)
+}
+
+// Store keeps the cookies set by a response from url, reporting whether there
+// were any.
+func (g *cookieGate) Store(url string, headers http.Header) bool {
+	if g == nil {
+		return false
+	}
+
+	cookies := (&http.Response{Header: headers}).Cookies()
+	if len(cookies) == 0 {
+		return false
+	}
+
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return false
+	}
+	g.jar.SetCookies(parsedUrl, cookies)
+	return true
+}
+
+// Retry reports whether a redirect from url to itself can be followed, which
+// is allowed once per url when the redirect set cookies.
+func (g *cookieGate) Retry(normalizedUrl string, setCookies bool) bool {
+	if g == nil || !setCookies || g.retried.Contains(normalizedUrl) {
+		return false
+	}
+
+	g.retried.Add(normalizedUrl)
+	return true
+}
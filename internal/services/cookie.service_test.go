@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"net/http"
+	"testing"
+)
+
+// cookieGateFetcher redirects https://example.com/gate to itself, setting a
+// cookie, until the cookie is sent back. With always set, it keeps
+// redirecting even then.
+func cookieGateFetcher(always bool) fetcherFunc {
+	return func(_ context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error) {
+		for _, cookie := range request.Cookies {
+			if cookie.Name == "consent" && !always {
+				return okResponse, nil
+			}
+		}
+
+		response := redirect(http.StatusFound, "/gate")
+		response.Headers.Set("Set-Cookie", "consent=yes; Path=/")
+		return response, nil
+	}
+}
+
+func TestTrackCookieGate(t *testing.T) {
+	response, err := NewTrackerService(cookieGateFetcher(false), WithCookieGate()).Track(context.Background(), "https://example.com/gate")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	if len(response.Checkpoints) != 2 || response.Checkpoints[1].Status != http.StatusOK {
+		t.Fatalf("checkpoints = %+v, want the redirect and the 200 retry", response.Checkpoints)
+	}
+	if response.Checkpoints[1].Note == "" {
+		t.Error("the retry has no note")
+	}
+}
+
+func TestTrackCookieGateRetriesOnce(t *testing.T) {
+	_, err := NewTrackerService(cookieGateFetcher(true), WithCookieGate()).Track(context.Background(), "https://example.com/gate")
+	if !errors.Is(err, ErrCircularRedirection) {
+		t.Errorf("Track() error = %v, want %v", err, ErrCircularRedirection)
+	}
+}
+
+func TestTrackCookieGateOffByDefault(t *testing.T) {
+	_, err := NewTrackerService(cookieGateFetcher(false)).Track(context.Background(), "https://example.com/gate")
+	if !errors.Is(err, ErrCircularRedirection) {
+		t.Errorf("Track() error = %v, want %v", err, ErrCircularRedirection)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Headers are a hop's response headers keyed by lowercased name, so they can
+// be looked up and compared across hops however the servers cased them. In
+// JSON a header sent once is a string, and one sent several times, like
+// Set-Cookie, an array of strings.
+type Headers map[string][]string
+
+// NewHeaders returns headers keyed by lowercased name.
+func NewHeaders(headers http.Header) Headers {
+	if headers == nil {
+		return nil
+	}
+
+	h := make(Headers, len(headers))
+	for name, values := range headers {
+		name = strings.ToLower(name)
+		h[name] = append(h[name], values...)
+	}
+	return h
+}
+
+// Get returns the first value of the header name, in any case, or an empty
+// string when it wasn't sent.
+func (h Headers) Get(name string) string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Values returns every value of the header name, in any case.
+func (h Headers) Values(name string) []string {
+	return h[strings.ToLower(name)]
+}
+
+func (h Headers) MarshalJSON() ([]byte, error) {
+	if h == nil {
+		return []byte("null"), nil
+	}
+
+	flattened := make(map[string]any, len(h))
+	for name, values := range h {
+		if len(values) == 1 {
+			flattened[name] = values[0]
+		} else {
+			flattened[name] = values
+		}
+	}
+	return json.Marshal(flattened)
+}
+
+func (h *Headers) UnmarshalJSON(data []byte) error {
+	var flattened map[string]json.RawMessage
+	if err := json.Unmarshal(data, &flattened); err != nil {
+		return err
+	}
+	if flattened == nil {
+		*h = nil
+		return nil
+	}
+
+	*h = make(Headers, len(flattened))
+	for name, raw := range flattened {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			(*h)[strings.ToLower(name)] = []string{value}
+			continue
+		}
+
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return err
+		}
+		(*h)[strings.ToLower(name)] = values
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"net/http"
+)
+
+type RedirectType string
+
+const (
+	RedirectTypePermanent RedirectType = "permanent"
+	RedirectTypeTemporary RedirectType = "temporary"
+)
+
+// RedirectTypeOf classifies a status code: 301 and 308 are permanent, 302, 303
+// and 307 are temporary, and anything else has no redirect type.
+func RedirectTypeOf(status int) RedirectType {
+	switch status {
+	case 301, 308:
+		return RedirectTypePermanent
+	case 302, 303, 307:
+		return RedirectTypeTemporary
+	default:
+		return ""
+	}
+}
+
+// IsRedirectStatus reports whether status is a redirect to follow: any 3xx but
+// 304 Not Modified, which answers a conditional request and ends the chain.
+func IsRedirectStatus(status int) bool {
+	return status >= 300 && status < 400 && status != http.StatusNotModified
+}
+
+// ParseRedirectType parses "permanent", "temporary" or "all", the latter
+// returning an empty RedirectType meaning every redirect is followed.
+func ParseRedirectType(value string) (RedirectType, error) {
+	switch value {
+	case "", "all":
+		return "", nil
+	case string(RedirectTypePermanent), string(RedirectTypeTemporary):
+		return RedirectType(value), nil
+	default:
+		return "", fmt.Errorf("invalid redirect type %q: expected permanent, temporary or all", value)
+	}
+}
+
+// nextFetcherRequest builds the request following a redirect with status to
+// url. 307 and 308 must repeat the request as is; for the other redirects the
+// method changes to GET and the body is dropped, matching browsers and
+// net/http. HEAD requests stay HEAD. Headers are only sent with the first hop.
+func nextFetcherRequest(previous clients.FetcherRequest, status int, url string) clients.FetcherRequest {
+	next := previous
+	next.Url = url
+	next.Headers = nil
+	if status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect {
+		return next
+	}
+
+	if next.Method != http.MethodHead {
+		next.Method = http.MethodGet
+	}
+	next.Body = nil
+	next.ContentType = ""
+	return next
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestTrackCarriesMethodAcrossRedirects(t *testing.T) {
+	tests := []struct {
+		status     int
+		wantMethod string
+		wantBody   string
+	}{
+		{http.StatusSeeOther, http.MethodGet, ""},
+		{http.StatusTemporaryRedirect, http.MethodPost, "a=1"},
+		{http.StatusPermanentRedirect, http.MethodPost, "a=1"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(strconv.Itoa(test.status), func(t *testing.T) {
+			var gotMethod, gotBody, gotContentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/start" {
+					http.Redirect(w, r, "/next", test.status)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				gotMethod, gotBody, gotContentType = r.Method, string(body), r.Header.Get("Content-Type")
+			}))
+			defer server.Close()
+
+			service := NewTrackerService(clients.NewHttpFetcherClient(),
+				WithInitialRequest(http.MethodPost, []byte("a=1"), "application/x-www-form-urlencoded"))
+			response, err := service.Track(context.Background(), server.URL+"/start")
+			if err != nil {
+				t.Fatalf("Track() error = %v", err)
+			}
+
+			if gotMethod != test.wantMethod || gotBody != test.wantBody {
+				t.Errorf("next hop got %s %q, want %s %q", gotMethod, gotBody, test.wantMethod, test.wantBody)
+			}
+			if test.wantBody == "" && gotContentType != "" {
+				t.Errorf("next hop got Content-Type %q without a body", gotContentType)
+			}
+			if len(response.Checkpoints) != 2 {
+				t.Fatalf("got %d checkpoints, want 2", len(response.Checkpoints))
+			}
+			if method := response.Checkpoints[0].Method; method != http.MethodPost {
+				t.Errorf("first checkpoint method = %s, want POST", method)
+			}
+			if method := response.Checkpoints[1].Method; method != test.wantMethod {
+				t.Errorf("second checkpoint method = %s, want %s", method, test.wantMethod)
+			}
+		})
+	}
+}
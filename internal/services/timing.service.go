@@ -0,0 +1,118 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerTiming is a metric a hop reported in its Server-Timing header, like a
+// CDN's cache lookup time.
+type ServerTiming struct {
+	Name        string        `json:"name"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Description string        `json:"description,omitempty"`
+}
+
+// parseServerTimings reads the metrics of every Server-Timing header, like
+// `cache;desc="Cache Read";dur=23.2, db;dur=53`. Malformed metrics are
+// skipped.
+func parseServerTimings(headers http.Header) []ServerTiming {
+	var timings []ServerTiming
+	for _, value := range headers.Values("Server-Timing") {
+		for _, metric := range splitQuoted(value, ',') {
+			if timing, ok := parseServerTiming(metric); ok {
+				timings = append(timings, timing)
+			}
+		}
+	}
+	return timings
+}
+
+func parseServerTiming(metric string) (ServerTiming, bool) {
+	params := splitQuoted(metric, ';')
+	timing := ServerTiming{Name: strings.TrimSpace(params[0])}
+	if !isToken(timing.Name) {
+		return ServerTiming{}, false
+	}
+
+	for _, param := range params[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = unquote(strings.TrimSpace(value))
+
+		switch key {
+		case "dur":
+			milliseconds, err := strconv.ParseFloat(value, 64)
+			// ParseFloat also accepts NaN and infinities, and durations
+			// past time.Duration's range would overflow it.
+			nanoseconds := milliseconds * float64(time.Millisecond)
+			if err != nil || math.IsNaN(milliseconds) || math.IsInf(milliseconds, 0) || milliseconds < 0 || nanoseconds >= math.MaxInt64 {
+				return ServerTiming{}, false
+			}
+			timing.Duration = time.Duration(nanoseconds)
+		case "desc":
+			timing.Description = value
+		}
+	}
+
+	return timing, true
+}
+
+// splitQuoted splits s at every sep outside of a double-quoted string.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns the content of a quoted-string, or value as is when it
+// isn't quoted.
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var builder strings.Builder
+	escaped := false
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		builder.WriteByte(value[i])
+	}
+	return builder.String()
+}
+
+// isToken reports whether s is a non-empty HTTP token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseServerTimings(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []ServerTiming
+	}{
+		{"duration and description", `cache;desc="Cache Read";dur=23.2`, []ServerTiming{{Name: "cache", Duration: 23200 * time.Microsecond, Description: "Cache Read"}}},
+		{"several metrics", `db;dur=53, app`, []ServerTiming{{Name: "db", Duration: 53 * time.Millisecond}, {Name: "app"}}},
+		{"quoted separators", `edge;desc="a, b; c"`, []ServerTiming{{Name: "edge", Description: "a, b; c"}}},
+		{"upper case dur", `db;DUR=1`, []ServerTiming{{Name: "db", Duration: time.Millisecond}}},
+		{"invalid name", `"db";dur=1, app;dur=2`, []ServerTiming{{Name: "app", Duration: 2 * time.Millisecond}}},
+		{"negative duration", `db;dur=-1, app`, []ServerTiming{{Name: "app"}}},
+		{"malformed duration", `db;dur=fast, app`, []ServerTiming{{Name: "app"}}},
+		{"NaN duration", `db;dur=NaN, app`, []ServerTiming{{Name: "app"}}},
+		{"infinite duration", `db;dur=Inf, app`, []ServerTiming{{Name: "app"}}},
+		{"positive infinite duration", `db;dur=+Inf, app`, []ServerTiming{{Name: "app"}}},
+		{"negative infinite duration", `db;dur=-Inf, app`, []ServerTiming{{Name: "app"}}},
+		{"duration past time.Duration", `db;dur=9223372036855, app`, []ServerTiming{{Name: "app"}}},
+		{"large duration", `db;dur=1e9`, []ServerTiming{{Name: "db", Duration: 1e9 * time.Millisecond}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseServerTimings(http.Header{"Server-Timing": {test.header}})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseServerTimings(%q) = %+v, want %+v", test.header, got, test.want)
+			}
+		})
+	}
+}
@@ -2,95 +2,552 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jorgejr568/wheregoes/internal/clients"
 	"github.com/jorgejr568/wheregoes/internal/pkg/set"
 	"github.com/jorgejr568/wheregoes/internal/utils"
+	"net/http"
 	urlPkg "net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	ErrCircularRedirection = fmt.Errorf("circular redirection detected")
+	ErrTrackerPanic        = fmt.Errorf("tracker panicked")
+	ErrInvalidUrl          = fmt.Errorf("invalid url: expected an http or https url")
+	ErrTooManyDomains      = fmt.Errorf("too many distinct domains in the redirect chain")
+	ErrTooManyRedirects    = fmt.Errorf("too many redirects")
+	ErrHopOverBudget       = fmt.Errorf("hop exceeded the latency budget")
+	ErrChainOverBudget     = fmt.Errorf("chain exceeded the total latency budget")
 )
 
 type TrackCheckpoint struct {
-	Url     string        `json:"url"`
-	Status  int           `json:"status"`
-	Latency time.Duration `json:"latency"`
+	Url          string        `json:"url"`
+	Status       int           `json:"status"`
+	Latency      time.Duration `json:"latency"`
+	RedirectType RedirectType  `json:"redirectType,omitempty"`
+	// Timestamp is when the hop's response was received, to line the chain
+	// up with server logs. Destinations recorded without being fetched carry
+	// the time they were recorded.
+	Timestamp time.Time `json:"timestamp"`
+	// HostChanged, PathChanged and QueryChanged tell what the hop's url
+	// changed from the previous hop's, e.g. only the query for a redirect
+	// appending tracking parameters. They're all false on the first hop.
+	HostChanged  bool `json:"hostChanged,omitempty"`
+	PathChanged  bool `json:"pathChanged,omitempty"`
+	QueryChanged bool `json:"queryChanged,omitempty"`
+	// Method is the HTTP method the hop was requested with.
+	Method string `json:"method,omitempty"`
+	// Protocol is the protocol the hop was answered with, like "HTTP/1.1".
+	Protocol string `json:"protocol,omitempty"`
+	// Note explains anything unusual about the hop, like a destination that
+	// wasn't fetched because it isn't on the web.
+	Note string `json:"note,omitempty"`
+	// Slow reports whether Latency exceeded the threshold set with
+	// WithSlowThreshold.
+	Slow bool `json:"slow,omitempty"`
+	// Injected marks hops added with WithInjectedHop, known beforehand and
+	// never fetched by the tracker.
+	Injected bool `json:"injected,omitempty"`
+	// Elided is set on the checkpoint standing for the hops left out of a
+	// chain compacted with WithCompactChain, to their number.
+	Elided int `json:"elided,omitempty"`
+	// Date and LastModified are the hop's Date and Last-Modified headers, to
+	// tell how stale each cache along the chain is. They're only set when the
+	// header is present and parses as a date.
+	Date         *time.Time `json:"date,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	// ServerTiming holds the metrics the hop reported in its Server-Timing
+	// header, e.g. a CDN's own durations to compare with Latency.
+	ServerTiming []ServerTiming `json:"serverTiming,omitempty"`
+	// Headers are the hop's response headers, see WithHeaderCapture.
+	Headers Headers `json:"headers,omitempty"`
+	// Request is how the hop was requested, see WithRequestCapture. Hops
+	// that weren't fetched have none.
+	Request *HopRequest `json:"request,omitempty"`
+}
+
+// HopRequest is the request a hop was fetched with, along with the
+// checkpoint's Url and Method.
+type HopRequest struct {
+	// Headers are the headers sent, keyed by lowercased name, with
+	// credentials redacted. Headers the transport adds on its own, like Host
+	// and Accept-Encoding, aren't included.
+	Headers Headers `json:"headers,omitempty"`
+	Body    string  `json:"body,omitempty"`
 }
 
 type TrackResponse struct {
 	Url         string            `json:"url"`
 	Checkpoints []TrackCheckpoint `json:"checkpoints"`
+	// ReturnsToOrigin reports whether the chain left the registrable domain it
+	// started from and later came back to it (common in OAuth/consent flows).
+	ReturnsToOrigin bool `json:"returnsToOrigin"`
+	// StopReason explains why a redirect wasn't followed, when the chain ended
+	// on a redirect because of the tracker's configuration.
+	StopReason string `json:"stopReason,omitempty"`
+	// FinalTitle is the <title> of the final page, see WithFinalTitle.
+	FinalTitle string `json:"finalTitle,omitempty"`
+	// CanonicalUrl and OgUrl are the final page's <link rel="canonical"> and
+	// og:url, see WithSEO.
+	CanonicalUrl string `json:"canonicalUrl,omitempty"`
+	OgUrl        string `json:"ogUrl,omitempty"`
+	// ErrorBody is the start of the final page's body when it's an error
+	// (4xx or 5xx), see WithErrorBodyCapture.
+	ErrorBody string `json:"errorBody,omitempty"`
+}
+
+// HopCount returns the number of hops of the chain, including those elided
+// by WithCompactChain.
+func (r TrackResponse) HopCount() int {
+	hops := 0
+	for _, checkpoint := range r.Checkpoints {
+		if checkpoint.Elided > 0 {
+			hops += checkpoint.Elided
+		} else {
+			hops++
+		}
+	}
+	return hops
 }
 
 type TrackChannelResponse struct {
 	Checkpoint *TrackCheckpoint
 	Err        error
 	Finished   bool
+	// Response holds the whole chain once Finished is set, or the chain up
+	// to the hop going over a latency budget along with Err, see
+	// IsPartialChainError.
+	Response *TrackResponse
 }
 
+// TrackerService is safe for concurrent use, so a single instance should be
+// created per process and shared by every caller.
 type TrackerService interface {
+	// Track follows the chain on the caller's goroutine and returns it once
+	// finished. Callers that don't stream hops should prefer it, as it
+	// spares TrackChannel's goroutine, channel and per-hop sends. When the
+	// error is a partial chain error, the chain recorded up to it is
+	// returned along with it.
 	Track(ctx context.Context, url string) (TrackResponse, error)
+	// TrackChannel follows the chain on a goroutine of its own, sending each
+	// checkpoint as soon as it's recorded, then the finished response or the
+	// error. The channel is closed after the last message, or early when ctx
+	// is done.
 	TrackChannel(ctx context.Context, url string) <-chan TrackChannelResponse
 }
 
-type defaultTrackerService struct {
-	fetcher clients.FetcherClient
+// checkpointsCapacity is preallocated for every chain. Most chains are a few
+// hops long, so this avoids regrowing the slice without oversizing one-hop
+// tracks.
+const checkpointsCapacity = 4
+
+// DefaultMaxBodyBytes bounds how much of a response body is read when a
+// feature needs it.
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultTimeout bounds tracks whose context has no deadline, so a server that
+// never answers can't hang them forever.
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultBodyReadTimeout bounds how long reading a response body may take when
+// a feature needs it.
+const DefaultBodyReadTimeout = 5 * time.Second
+
+type trackerConfig struct {
+	normalizeTrailingSlash bool
+	followOnly             RedirectType
+	maxBodyBytes           int64
+	bodyReadTimeout        time.Duration
+	htmlContentTypes       []string
+	finalTitle             bool
+	seo                    bool
+	errorBodyBytes         int
+	captureHeaders         bool
+	captureRequests        bool
+	initialMethod          string
+	initialBody            []byte
+	initialContentType     string
+	allowedSchemes         set.Set[string]
+	allowedPorts           set.Set[int]
+	slowThreshold          time.Duration
+	hopBudget              time.Duration
+	totalLatencyBudget     time.Duration
+	maxDomains             int
+	cookieGate             bool
+	maxRedirects           int
+	maxDuration            time.Duration
+	defaultTimeout         time.Duration
+	followMetaRefresh      bool
+	metaRefreshStatuses    set.Set[int]
+	stopAt                 func(url string) bool
+	sameDomainOnly         bool
+	referer                string
+	refererChain           bool
+	visitedSetFactory      func() set.Set[string]
+	clock                  Clock
+	initialHeaders         http.Header
+	basicAuth              string
+	authForwarding         AuthForwarding
+	hopDelay               time.Duration
+	injectedHops           []TrackCheckpoint
+	compactChain           bool
+	compactKeepFirst       int
+	compactKeepLast        int
 }
 
-func (t *defaultTrackerService) Track(ctx context.Context, url string) (TrackResponse, error) {
-	var checkpoints []TrackCheckpoint
-	visitedNodes := set.New[string]()
-	for {
-		now := time.Now()
-		res, err := t.fetcher.Fetch(ctx, url)
-		duration := time.Since(now)
-		if err != nil {
-			return TrackResponse{}, err
-		}
+func (c *trackerConfig) readsBody() bool {
+	return c.finalTitle || c.seo || c.followMetaRefresh || c.errorBodyBytes > 0
+}
 
-		checkpoints = append(checkpoints, TrackCheckpoint{
-			Url:     url,
-			Latency: duration,
-			Status:  res.StatusCode,
-		})
+type TrackerOption func(config *trackerConfig)
 
-		isRedirect := res.StatusCode >= 300 && res.StatusCode < 400
-		if !isRedirect {
-			break
-		}
+// WithTrailingSlashNormalization makes circular redirection detection treat
+// "/a" and "/a/" as the same URL. Fragments are always ignored, since they are
+// never sent to the server, and scheme and host are always compared
+// case-insensitively.
+func WithTrailingSlashNormalization() TrackerOption {
+	return func(config *trackerConfig) {
+		config.normalizeTrailingSlash = true
+	}
+}
+
+// WithFollowOnly restricts the redirects followed to the given type. The chain
+// stops, with a StopReason, at the first redirect of any other kind.
+func WithFollowOnly(redirectType RedirectType) TrackerOption {
+	return func(config *trackerConfig) {
+		config.followOnly = redirectType
+	}
+}
+
+// WithBodyReadTimeout bounds how long reading a response body may take,
+// DefaultBodyReadTimeout by default. Hops whose body takes longer keep what
+// was read so far and are marked "body read timed out". Zero disables it.
+func WithBodyReadTimeout(timeout time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.bodyReadTimeout = timeout
+	}
+}
+
+// WithMaxBodyBytes bounds how much of a response body is read by features that
+// need it, DefaultMaxBodyBytes by default.
+func WithMaxBodyBytes(maxBodyBytes int64) TrackerOption {
+	return func(config *trackerConfig) {
+		config.maxBodyBytes = maxBodyBytes
+	}
+}
+
+// WithHTMLContentTypes sets the content types whose bodies are parsed as HTML
+// by body-based features, utils.DefaultHTMLContentTypes by default. Bodies of
+// any other content type (JSON, images...) are only read by
+// WithErrorBodyCapture.
+func WithHTMLContentTypes(contentTypes []string) TrackerOption {
+	return func(config *trackerConfig) {
+		config.htmlContentTypes = contentTypes
+	}
+}
+
+// WithInitialRequest sends the first hop with method and body instead of a
+// plain GET. Redirects carry them forward like browsers do: 307 and 308 keep
+// the method and body, while 301, 302 and 303 switch to a GET without a body
+// (except for HEAD, which stays HEAD).
+func WithInitialRequest(method string, body []byte, contentType string) TrackerOption {
+	return func(config *trackerConfig) {
+		config.initialMethod = method
+		config.initialBody = body
+		config.initialContentType = contentType
+	}
+}
 
-		url = t.transformLocationUrl(res.Headers.Get("Location"), url)
-		if url == "" {
-			break
+// WithInitialHeaders sends headers with the first hop only, like the
+// If-Modified-Since and If-None-Match of a conditional request. A 304 Not
+// Modified answer ends the chain.
+func WithInitialHeaders(headers http.Header) TrackerOption {
+	return func(config *trackerConfig) {
+		config.initialHeaders = headers
+	}
+}
+
+// WithFinalTitle reads the final page's body to fill TrackResponse.FinalTitle.
+func WithFinalTitle() TrackerOption {
+	return func(config *trackerConfig) {
+		config.finalTitle = true
+	}
+}
+
+// WithSEO reads the final page's body to fill TrackResponse.CanonicalUrl and
+// TrackResponse.OgUrl, which can differ from the landing url.
+func WithSEO() TrackerOption {
+	return func(config *trackerConfig) {
+		config.seo = true
+	}
+}
+
+// WithErrorBodyCapture fills TrackResponse.ErrorBody with up to maxBytes of
+// the final page's body when it answered with a 4xx or 5xx, to tell real
+// errors from bot walls. The snippet is made printable, and the body read is
+// still bounded by WithMaxBodyBytes.
+func WithErrorBodyCapture(maxBytes int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.errorBodyBytes = maxBytes
+	}
+}
+
+// WithHeaderCapture fills each checkpoint's Headers with the hop's response
+// headers, keyed by lowercased name. Headers over the fetcher's
+// WithMaxHeaders or WithMaxHeaderBytes limits are left out.
+func WithHeaderCapture() TrackerOption {
+	return func(config *trackerConfig) {
+		config.captureHeaders = true
+	}
+}
+
+// DefaultAllowedSchemes are the schemes redirects are followed into.
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// WithAllowedSchemes restricts the schemes redirects are followed into,
+// DefaultAllowedSchemes by default. A redirect to any other scheme ends the
+// chain, unfetched, with a StopReason. Passing only "https" refuses downgrades.
+// Only http and https can actually be fetched.
+func WithAllowedSchemes(schemes []string) TrackerOption {
+	return func(config *trackerConfig) {
+		config.allowedSchemes = set.New[string]()
+		for _, scheme := range schemes {
+			config.allowedSchemes.Add(strings.ToLower(strings.TrimSpace(scheme)))
 		}
+	}
+}
 
-		if visitedNodes.Contains(url) {
-			return TrackResponse{}, ErrCircularRedirection
+// WithAllowedPorts restricts the ports hops are fetched from, the first one
+// included, to lock a server down to e.g. 80 and 443 against requests to
+// internal services. Urls without a port use their scheme's default. A hop on
+// any other port ends the chain, unfetched, with a StopReason. Every port is
+// allowed when ports is empty, the default.
+func WithAllowedPorts(ports []int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.allowedPorts = nil
+		if len(ports) > 0 {
+			config.allowedPorts = set.NewFromSlice(ports)
 		}
+	}
+}
 
-		visitedNodes.Add(url)
+// WithSlowThreshold marks checkpoints whose latency exceeds threshold as Slow.
+func WithSlowThreshold(threshold time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.slowThreshold = threshold
 	}
+}
 
-	return TrackResponse{
-		Url:         url,
-		Checkpoints: checkpoints,
-	}, nil
+// WithHopBudget fails tracks with ErrHopOverBudget at the first hop slower
+// than budget, once its checkpoint is recorded. Unlike WithSlowThreshold,
+// which only marks such hops, it suits audits holding links to a latency SLO.
+func WithHopBudget(budget time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.hopBudget = budget
+	}
 }
 
-func (t *defaultTrackerService) transformLocationUrl(locationUrl string, previousUrl string) string {
-	if utils.IsUrl(locationUrl) {
-		return locationUrl
+// WithTotalLatencyBudget fails tracks with ErrChainOverBudget once the sum
+// of their hops' latencies exceeds budget, after the hop going over it is
+// recorded. Unlike WithMaxDuration, time spent waiting between hops, for
+// WithHopDelay or a rate limit, doesn't count.
+func WithTotalLatencyBudget(budget time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.totalLatencyBudget = budget
 	}
+}
 
-	parsedPreviousUrl, err := urlPkg.Parse(previousUrl)
+// WithMaxDomains fails tracks with ErrTooManyDomains once the chain would
+// visit more than maxDomains distinct registrable domains, which catches
+// chains bouncing through many domains to dodge circular detection.
+func WithMaxDomains(maxDomains int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.maxDomains = maxDomains
+	}
+}
+
+// WithCookieGate keeps cookies across the hops of each track, like a browser
+// does, and lets a redirect back to the same url through once when it sets a
+// cookie. That's the cookie gate pattern (GET /x sets a cookie and redirects to
+// /x, expecting it on the retry), which would otherwise be reported as
+// ErrCircularRedirection. A second redirect to the same url still is. Cookies
+// are never shared between tracks.
+func WithCookieGate() TrackerOption {
+	return func(config *trackerConfig) {
+		config.cookieGate = true
+	}
+}
+
+// WithMaxRedirects fails tracks with ErrTooManyRedirects once the chain would
+// follow more than maxRedirects redirects. Chains are unbounded by default and
+// only stop on circular redirections.
+func WithMaxRedirects(maxRedirects int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.maxRedirects = maxRedirects
+	}
+}
+
+// WithMaxDuration bounds how long a whole track can take, failing it with
+// context.DeadlineExceeded.
+func WithMaxDuration(maxDuration time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.maxDuration = maxDuration
+	}
+}
+
+// WithDefaultTimeout bounds tracks whose context has no deadline when
+// WithMaxDuration isn't used, DefaultTimeout by default. Zero lets them run
+// for as long as their context allows.
+func WithDefaultTimeout(timeout time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.defaultTimeout = timeout
+	}
+}
+
+// WithFollowMetaRefresh follows <meta http-equiv="refresh"> redirects in HTML
+// pages, as browsers do, on top of 3xx ones. Refreshes that reload the same
+// page end the chain. Only pages answered with one of the statuses set with
+// WithMetaRefreshStatuses are followed.
+func WithFollowMetaRefresh() TrackerOption {
+	return func(config *trackerConfig) {
+		config.followMetaRefresh = true
+	}
+}
+
+// DefaultMetaRefreshStatuses are the statuses of the pages whose meta
+// refreshes are followed.
+var DefaultMetaRefreshStatuses = []int{http.StatusOK}
+
+// WithMetaRefreshStatuses sets the statuses of the pages whose meta refreshes
+// WithFollowMetaRefresh follows, DefaultMetaRefreshStatuses by default, e.g.
+// to also follow the custom 404 or 410 pages redirecting somewhere else.
+func WithMetaRefreshStatuses(statuses []int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.metaRefreshStatuses = set.NewFromSlice(statuses)
+	}
+}
+
+// WithStopAt ends the chain, with a StopReason, before fetching a url for
+// which stopAt returns true. The url is still recorded, unfetched.
+func WithStopAt(stopAt func(url string) bool) TrackerOption {
+	return func(config *trackerConfig) {
+		config.stopAt = stopAt
+	}
+}
+
+// WithRequestCapture fills each fetched checkpoint's Request with the
+// headers and body the hop was requested with, e.g. to reproduce it by hand.
+// Authorization headers are redacted, keeping only their scheme.
+func WithRequestCapture() TrackerOption {
+	return func(config *trackerConfig) {
+		config.captureRequests = true
+	}
+}
+
+// WithSameDomainOnly ends the chain, with a StopReason, before fetching the
+// first url outside the registrable domain the chain started on, like the
+// handoff to a tracker. That url is still recorded, unfetched.
+func WithSameDomainOnly() TrackerOption {
+	return func(config *trackerConfig) {
+		config.sameDomainOnly = true
+	}
+}
+
+// WithReferer sends referer as the Referer header of every hop, for chains
+// guarded by referer checks.
+func WithReferer(referer string) TrackerOption {
+	return func(config *trackerConfig) {
+		config.referer = referer
+	}
+}
+
+// WithRefererChain sends the previous hop's url as the Referer header of every
+// hop after the first, like a browser clicking through each page would. The
+// first hop keeps the one set with WithReferer, if any.
+func WithRefererChain() TrackerOption {
+	return func(config *trackerConfig) {
+		config.refererChain = true
+	}
+}
+
+// WithVisitedSetFactory sets how the set of urls visited by each track, used
+// for circular redirection detection, is created. set.New by default.
+func WithVisitedSetFactory(factory func() set.Set[string]) TrackerOption {
+	return func(config *trackerConfig) {
+		config.visitedSetFactory = factory
+	}
+}
+
+// WithHopDelay waits delay before fetching each hop after the first, to go easy
+// on a single origin. The wait isn't part of any hop's latency.
+func WithHopDelay(delay time.Duration) TrackerOption {
+	return func(config *trackerConfig) {
+		config.hopDelay = delay
+	}
+}
+
+// WithInjectedHop records url, answered with status, as a hop before the
+// tracked url without fetching it, e.g. a shortener already resolved by other
+// means. The chain then reads as if tracked from url. The checkpoint is marked
+// Injected. Calling it several times injects hops in call order.
+func WithInjectedHop(url string, status int) TrackerOption {
+	return func(config *trackerConfig) {
+		config.injectedHops = append(config.injectedHops, TrackCheckpoint{
+			Url:          url,
+			Status:       status,
+			RedirectType: RedirectTypeOf(status),
+			Note:         "injected, not fetched",
+			Injected:     true,
+		})
+	}
+}
+
+// WithCompactChain keeps only the first keepFirst and last keepLast
+// checkpoints of the TrackResponse of chains longer than both together, to
+// bound the memory of many concurrent tracks of abusive chains. The ones in
+// between are replaced with a single checkpoint, with no url, whose Elided
+// counts them. Checkpoints are still all sent by TrackChannel as they're
+// recorded. Values below 1 count as 1, so both ends of the chain are kept.
+func WithCompactChain(keepFirst int, keepLast int) TrackerOption {
+	return func(config *trackerConfig) {
+		if keepFirst < 1 {
+			keepFirst = 1
+		}
+		if keepLast < 1 {
+			keepLast = 1
+		}
+		config.compactChain = true
+		config.compactKeepFirst = keepFirst
+		config.compactKeepLast = keepLast
+	}
+}
+
+type defaultTrackerService struct {
+	fetcher clients.FetcherClient
+	config  trackerConfig
+}
+
+func (t *defaultTrackerService) Track(ctx context.Context, url string) (response TrackResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			response, err = TrackResponse{}, panicError(r)
+		}
+	}()
+
+	chain := t.newChainLog()
+	result, err := t.follow(ctx, url, chain.add)
 	if err != nil {
-		return ""
+		if IsPartialChainError(err) {
+			return t.newResponse(chain, result), err
+		}
+		return TrackResponse{}, err
 	}
 
-	return fmt.Sprintf("%s://%s%s", parsedPreviousUrl.Scheme, parsedPreviousUrl.Host, locationUrl)
+	return t.newResponse(chain, result), nil
 }
 
 func (t *defaultTrackerService) TrackChannel(ctx context.Context, url string) <-chan TrackChannelResponse {
@@ -98,57 +555,548 @@ func (t *defaultTrackerService) TrackChannel(ctx context.Context, url string) <-
 
 	go func() {
 		defer close(ch)
-		visitedNodes := set.New[string]()
-		for {
-			now := time.Now()
-			res, err := t.fetcher.Fetch(ctx, url)
-			duration := time.Since(now)
-			if err != nil {
-				ch <- TrackChannelResponse{
-					Err: err,
-				}
-				return
+		send := func(response TrackChannelResponse) {
+			select {
+			case ch <- response:
+			case <-ctx.Done():
 			}
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				send(TrackChannelResponse{Err: panicError(r)})
+			}
+		}()
+
+		chain := t.newChainLog()
+		result, err := t.follow(ctx, url, func(checkpoint TrackCheckpoint) {
+			chain.add(checkpoint)
+			send(TrackChannelResponse{Checkpoint: &checkpoint})
+		})
+		if err != nil {
+			message := TrackChannelResponse{Err: err}
+			if IsPartialChainError(err) {
+				partial := t.newResponse(chain, result)
+				message.Response = &partial
+			}
+			send(message)
+			return
+		}
+
+		response := t.newResponse(chain, result)
+		send(TrackChannelResponse{Finished: true, Response: &response})
+	}()
+
+	return ch
+}
+
+// IsPartialChainError reports whether err ended a track on a latency budget,
+// ErrHopOverBudget or ErrChainOverBudget, in which case the chain up to the
+// hop going over it is returned along with err, its StopReason telling why,
+// for the hops that used the budget up to be reported.
+func IsPartialChainError(err error) bool {
+	return errors.Is(err, ErrHopOverBudget) || errors.Is(err, ErrChainOverBudget)
+}
+
+// panicError converts a value recovered from a panic while tracking into an
+// error wrapping ErrTrackerPanic, so a misbehaving hop can't crash the process.
+func panicError(r any) error {
+	return fmt.Errorf("%w: %v", ErrTrackerPanic, r)
+}
+
+type followResult struct {
+	url        string
+	stopReason string
+	// document is the final hop's parsed body, read only when a feature
+	// needs it.
+	document utils.HTMLDocument
+	// errorBody is the start of the final hop's body when it's an error, see
+	// WithErrorBodyCapture.
+	errorBody string
+}
+
+func (t *defaultTrackerService) newResponse(chain *chainLog, result followResult) TrackResponse {
+	response := TrackResponse{
+		Url:             result.url,
+		Checkpoints:     chain.checkpoints(),
+		ReturnsToOrigin: chain.returnsToOrigin,
+		StopReason:      result.stopReason,
+	}
+
+	if t.config.finalTitle {
+		response.FinalTitle = result.document.Title
+	}
+	if t.config.seo {
+		response.CanonicalUrl = result.document.CanonicalUrl
+		response.OgUrl = result.document.OgUrl
+	}
+	response.ErrorBody = result.errorBody
+
+	return response
+}
+
+// follow walks the redirect chain starting at url, handing each checkpoint to
+// emit as soon as it's recorded, and returns the last url fetched.
+func (t *defaultTrackerService) follow(ctx context.Context, url string, emit func(TrackCheckpoint)) (followResult, error) {
+	if !utils.IsUrl(url) {
+		return followResult{url: url}, ErrInvalidUrl
+	}
+	emit = markUrlChanges(emit)
+	initialUrl := url
+
+	timeout := t.config.maxDuration
+	if _, hasDeadline := ctx.Deadline(); timeout <= 0 && !hasDeadline {
+		timeout = t.config.defaultTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	visitedNodes := t.config.visitedSetFactory()
+	for _, checkpoint := range t.config.injectedHops {
+		// Redirecting back to a known hop is as circular as to a fetched one.
+		visitedNodes.Add(t.normalize(checkpoint.Url))
+		checkpoint.Timestamp = t.config.clock.Now()
+		emit(checkpoint)
+	}
+	visitedNodes.Add(t.normalize(url))
+	originDomain := utils.RegistrableDomain(url)
+	visitedDomains := set.New[string]()
+	visitedDomains.Add(originDomain)
+	request := t.newFetcherRequest(url)
+	var cookies *cookieGate
+	if t.config.cookieGate {
+		cookies = newCookieGate()
+	}
+	note := ""
+	redirects := 0
+	var totalLatency time.Duration
+	for {
+		if port, allowed := t.portAllowed(url); !allowed {
+			emit(TrackCheckpoint{
+				Url:       url,
+				Timestamp: t.config.clock.Now(),
+				Note:      fmt.Sprintf("port %d not allowed, not fetched", port),
+			})
+			return followResult{
+				url:        url,
+				stopReason: fmt.Sprintf("stopped before %s, port %d isn't allowed", url, port),
+			}, nil
+		}
 
-			ch <- TrackChannelResponse{
-				Checkpoint: &TrackCheckpoint{
-					Url:     url,
-					Latency: duration,
-					Status:  res.StatusCode,
-				},
+		if redirects > 0 && t.config.hopDelay > 0 {
+			if err := sleepContext(ctx, t.config.hopDelay); err != nil {
+				return followResult{url: url}, err
 			}
+		}
 
-			if visitedNodes.Contains(url) {
-				ch <- TrackChannelResponse{
-					Err: ErrCircularRedirection,
-				}
-				return
+		request.Cookies = cookies.Cookies(url)
+		now := t.config.clock.Now()
+		res, err := t.fetcher.Fetch(ctx, request)
+		received := t.config.clock.Now()
+		duration := received.Sub(now)
+		if err != nil {
+			return followResult{url: url}, err
+		}
+		duration -= res.Waited
+		setCookies := cookies.Store(url, res.Headers)
+
+		if res.ExpandedBy != "" {
+			note = joinNotes(note, fmt.Sprintf("expanded with the %s API, not fetched", res.ExpandedBy))
+		}
+		if res.HeadersTruncated {
+			note = joinNotes(note, "headers truncated")
+		}
+		if res.BodyTimedOut {
+			note = joinNotes(note, "body read timed out")
+		}
+
+		isRedirect := IsRedirectStatus(res.StatusCode)
+		var document utils.HTMLDocument
+		if len(res.Body) > 0 && t.isHTML(res.Headers) {
+			document = utils.ParseHTML(res.Body, url)
+		}
+
+		location := ""
+		switch {
+		case isRedirect:
+			locations := res.Headers.Values("Location")
+			var repaired bool
+			location, repaired = t.redirectLocation(locations, url)
+			if len(locations) > 1 {
+				note = joinNotes(note, fmt.Sprintf("%d Location headers, possible header injection", len(locations)))
+			}
+			if repaired {
+				note = joinNotes(note, "Location percent-encoded")
 			}
+		case res.StatusCode == http.StatusNotModified:
+			note = joinNotes(note, "not modified")
+		default:
+			location = t.metaRefreshUrl(url, res.StatusCode, document)
+			if location != "" {
+				note = joinNotes(note, "meta refresh")
+			}
+		}
+
+		redirectType := RedirectTypeOf(res.StatusCode)
+		emit(TrackCheckpoint{
+			Url:          url,
+			Latency:      duration,
+			Timestamp:    received,
+			Status:       res.StatusCode,
+			RedirectType: redirectType,
+			Method:       request.Method,
+			Protocol:     res.Proto,
+			Slow:         t.config.slowThreshold > 0 && duration > t.config.slowThreshold,
+			Note:         note,
+			Date:         headerTime(res.Headers, "Date"),
+			LastModified: headerTime(res.Headers, "Last-Modified"),
+			ServerTiming: parseServerTimings(res.Headers),
+			Headers:      t.capturedHeaders(res.Headers),
+			Request:      t.capturedRequest(request, res),
+		})
+		note = ""
+
+		if t.config.hopBudget > 0 && duration > t.config.hopBudget {
+			err := fmt.Errorf("%w: %s took %s, over %s", ErrHopOverBudget, url, duration.Round(time.Millisecond), t.config.hopBudget)
+			return followResult{url: url, stopReason: err.Error()}, err
+		}
 
-			visitedNodes.Add(url)
-			isRedirect := res.StatusCode >= 300 && res.StatusCode < 400
-			if !isRedirect {
-				ch <- TrackChannelResponse{
-					Finished: true,
-				}
-				return
+		totalLatency += duration
+		if t.config.totalLatencyBudget > 0 && totalLatency > t.config.totalLatencyBudget {
+			err := fmt.Errorf("%w: hops took %s up to %s, over %s", ErrChainOverBudget, totalLatency.Round(time.Millisecond), url, t.config.totalLatencyBudget)
+			return followResult{url: url, stopReason: err.Error()}, err
+		}
+
+		if !isRedirect && location == "" {
+			result := followResult{url: url, document: document}
+			if t.config.errorBodyBytes > 0 && res.StatusCode >= 400 {
+				result.errorBody = utils.Snippet(res.Body, t.config.errorBodyBytes)
 			}
+			return result, nil
+		}
+
+		if location == "" {
+			return followResult{
+				url:        url,
+				stopReason: fmt.Sprintf("%d redirect without a Location header", res.StatusCode),
+			}, nil
+		}
+
+		if isRedirect && t.config.followOnly != "" && redirectType != t.config.followOnly {
+			return followResult{
+				url:        url,
+				stopReason: fmt.Sprintf("not following %d redirect, only %s redirects are followed", res.StatusCode, t.config.followOnly),
+			}, nil
+		}
+
+		nextUrl := t.transformLocationUrl(location, url)
+		if nextUrl == "" {
+			return followResult{
+				url:        url,
+				stopReason: fmt.Sprintf("not following redirect to malformed url %q", location),
+			}, nil
+		}
 
-			url = t.transformLocationUrl(res.Headers.Get("Location"), url)
-			if url == "" {
-				ch <- TrackChannelResponse{
-					Finished: true,
-				}
-				return
+		redirects++
+		if t.config.maxRedirects > 0 && redirects > t.config.maxRedirects {
+			return followResult{url: url}, fmt.Errorf("%w: more than %d", ErrTooManyRedirects, t.config.maxRedirects)
+		}
+
+		if scheme := utils.UrlScheme(nextUrl); !t.config.allowedSchemes.Contains(scheme) {
+			// Chains can end outside the web (mailto:, data:, app deep links)
+			// or somewhere unsafe to follow (javascript:). Record the
+			// destination without fetching it.
+			emit(TrackCheckpoint{
+				Url:       nextUrl,
+				Timestamp: t.config.clock.Now(),
+				Note:      fmt.Sprintf("%s: destination, not fetched", scheme),
+			})
+			return followResult{
+				url:        nextUrl,
+				stopReason: fmt.Sprintf("not following redirect to a %s: url, the scheme isn't allowed", scheme),
+			}, nil
+		}
+
+		if t.config.stopAt != nil && t.config.stopAt(nextUrl) {
+			emit(TrackCheckpoint{
+				Url:       nextUrl,
+				Timestamp: t.config.clock.Now(),
+				Note:      "stop condition matched, not fetched",
+			})
+			return followResult{
+				url:        nextUrl,
+				stopReason: fmt.Sprintf("stopped before %s, it matches the stop condition", nextUrl),
+			}, nil
+		}
+
+		if domain := utils.RegistrableDomain(nextUrl); t.config.sameDomainOnly && domain != originDomain {
+			emit(TrackCheckpoint{
+				Url:       nextUrl,
+				Timestamp: t.config.clock.Now(),
+				Note:      "other domain, not fetched",
+			})
+			return followResult{
+				url:        nextUrl,
+				stopReason: fmt.Sprintf("stopped before %s, it's outside %s", nextUrl, originDomain),
+			}, nil
+		}
+
+		normalizedUrl := t.normalize(nextUrl)
+		if visitedNodes.Contains(normalizedUrl) {
+			isSelfRedirect := normalizedUrl == t.normalize(url)
+			if !isSelfRedirect || !cookies.Retry(normalizedUrl, setCookies) {
+				return followResult{url: url}, ErrCircularRedirection
 			}
+			note = "retried with the cookies set by the previous hop"
 		}
-	}()
 
-	return ch
+		visitedNodes.Add(normalizedUrl)
+		visitedDomains.Add(utils.RegistrableDomain(nextUrl))
+		if t.config.maxDomains > 0 && visitedDomains.Len() > t.config.maxDomains {
+			return followResult{url: url}, fmt.Errorf("%w: more than %d", ErrTooManyDomains, t.config.maxDomains)
+		}
+
+		request = nextFetcherRequest(request, res.StatusCode, nextUrl)
+		request.Headers = t.authorize(request.Headers, initialUrl, nextUrl)
+		if t.config.refererChain {
+			// Fragments are never sent, not even in a Referer.
+			request.Referer = utils.NormalizeUrl(url, false)
+		}
+		url = nextUrl
+	}
+}
+
+// metaRefreshUrl returns where a meta refresh in document, answered with
+// status, leads, when following them is enabled for status and it doesn't
+// just reload url.
+func (t *defaultTrackerService) metaRefreshUrl(url string, status int, document utils.HTMLDocument) string {
+	if !t.config.followMetaRefresh || !t.config.metaRefreshStatuses.Contains(status) {
+		return ""
+	}
+
+	refreshUrl := document.RefreshUrl
+	if refreshUrl == "" || t.normalize(refreshUrl) == t.normalize(url) {
+		return ""
+	}
+	return refreshUrl
+}
+
+// headerTimeLayouts are the date formats accepted on top of the HTTP ones,
+// seen from misconfigured servers.
+var headerTimeLayouts = []string{time.RFC3339, time.RFC1123Z, "Mon, 2 Jan 2006 15:04:05 MST"}
+
+// headerTime parses the date of the header name, leniently, or returns nil
+// when it's missing or malformed.
+func headerTime(headers http.Header, name string) *time.Time {
+	value := strings.TrimSpace(headers.Get(name))
+	if value == "" {
+		return nil
+	}
+
+	if parsed, err := http.ParseTime(value); err == nil {
+		return &parsed
+	}
+	for _, layout := range headerTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for d, returning early with ctx's error if it's done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// capturedHeaders returns headers for a checkpoint, nil unless
+// WithHeaderCapture is set.
+func (t *defaultTrackerService) capturedHeaders(headers http.Header) Headers {
+	if !t.config.captureHeaders {
+		return nil
+	}
+	return NewHeaders(headers)
+}
+
+// capturedRequest returns the request of a hop fetched with request, which
+// answered res, when WithRequestCapture is used.
+func (t *defaultTrackerService) capturedRequest(request clients.FetcherRequest, res clients.FetcherResponse) *HopRequest {
+	if !t.config.captureRequests || res.RequestHeaders == nil {
+		return nil
+	}
+
+	headers := NewHeaders(res.RequestHeaders)
+	for _, name := range []string{"authorization", "proxy-authorization"} {
+		for i, value := range headers[name] {
+			scheme, _, _ := strings.Cut(value, " ")
+			headers[name][i] = scheme + " [redacted]"
+		}
+	}
+	return &HopRequest{Headers: headers, Body: string(request.Body)}
+}
+
+// isHTML reports whether a response with headers has an HTML body, per
+// WithHTMLContentTypes.
+func (t *defaultTrackerService) isHTML(headers http.Header) bool {
+	return len(t.config.htmlContentTypes) == 0 ||
+		utils.MatchesContentType(headers.Get("Content-Type"), t.config.htmlContentTypes)
+}
+
+func joinNotes(notes ...string) string {
+	nonEmpty := make([]string, 0, len(notes))
+	for _, note := range notes {
+		if note != "" {
+			nonEmpty = append(nonEmpty, note)
+		}
+	}
+	return strings.Join(nonEmpty, "; ")
+}
+
+func (t *defaultTrackerService) newFetcherRequest(url string) clients.FetcherRequest {
+	request := clients.FetcherRequest{
+		Url:         url,
+		Method:      http.MethodGet,
+		Body:        t.config.initialBody,
+		ContentType: t.config.initialContentType,
+		Headers:     t.authorize(t.config.initialHeaders, url, url),
+		Referer:     t.config.referer,
+	}
+	if t.config.initialMethod != "" {
+		request.Method = t.config.initialMethod
+	}
+	if t.config.readsBody() {
+		request.MaxBodyBytes = t.config.maxBodyBytes
+		// Error pages are captured whatever their type, so bodies are only
+		// restricted to HTML ones when not capturing them.
+		if t.config.errorBodyBytes == 0 {
+			request.BodyContentTypes = t.config.htmlContentTypes
+		}
+		request.BodyReadTimeout = t.config.bodyReadTimeout
+	}
+	request.CaptureRequestHeaders = t.config.captureRequests
+	return request
+}
+
+// portAllowed reports whether url's port, or its scheme's default one, is
+// allowed by WithAllowedPorts.
+func (t *defaultTrackerService) portAllowed(url string) (int, bool) {
+	if t.config.allowedPorts == nil {
+		return 0, true
+	}
+
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return 0, false
+	}
+
+	port, err := strconv.Atoi(parsedUrl.Port())
+	if err != nil {
+		port = defaultPorts[strings.ToLower(parsedUrl.Scheme)]
+	}
+	return port, t.config.allowedPorts.Contains(port)
+}
+
+// defaultPorts are the ports of urls of these schemes without one.
+var defaultPorts = map[string]int{"http": 80, "https": 443}
+
+func (t *defaultTrackerService) normalize(url string) string {
+	return utils.NormalizeUrl(url, t.config.normalizeTrailingSlash)
 }
 
-func NewTrackerService(fetcher clients.FetcherClient) TrackerService {
+// transformLocationUrl resolves locationUrl, a Location header or meta
+// refresh target, against previousUrl, the url it was found at, the way RFC
+// 3986 resolves references: relative paths, "//host/path" and "?query" ones
+// included. Urls of other schemes, like mailto:, are returned as is. It
+// returns an empty string when the result wouldn't be a fetchable http(s) url,
+// so nothing malformed is ever requested.
+func (t *defaultTrackerService) transformLocationUrl(locationUrl string, previousUrl string) string {
+	locationUrl = strings.TrimSpace(locationUrl)
+	if scheme := utils.UrlScheme(locationUrl); scheme != "" && scheme != "http" && scheme != "https" {
+		return locationUrl
+	}
+
+	parsedPreviousUrl, err := urlPkg.Parse(previousUrl)
+	if err != nil {
+		return ""
+	}
+
+	parsedLocationUrl, err := urlPkg.Parse(locationUrl)
+	if err != nil {
+		return ""
+	}
+
+	nextUrl := parsedPreviousUrl.ResolveReference(parsedLocationUrl)
+	if nextUrl.Host == "" || (nextUrl.Scheme != "http" && nextUrl.Scheme != "https") {
+		return ""
+	}
+	return nextUrl.String()
+}
+
+// redirectLocation picks which of the Location headers of a redirect from url
+// is followed. Servers must send a single one, but misbehaving ones, or ones
+// open to header injection, can send several. The first non-empty one that
+// resolves to a url wins, so a blank or malformed value sent first doesn't
+// end the chain. When none resolves, the first non-empty one is returned, for
+// the chain to stop on. Values are repaired with utils.RepairUrl first, as
+// browsers do, and repaired reports whether the returned one was.
+func (t *defaultTrackerService) redirectLocation(locations []string, url string) (location string, repaired bool) {
+	first := ""
+	for _, location := range locations {
+		if strings.TrimSpace(location) == "" {
+			continue
+		}
+		if repairedLocation := utils.RepairUrl(location); t.transformLocationUrl(repairedLocation, url) != "" {
+			return repairedLocation, repairedLocation != strings.TrimSpace(location)
+		}
+		if first == "" {
+			first = location
+		}
+	}
+	return first, false
+}
+
+// markUrlChanges wraps emit to fill each checkpoint's HostChanged,
+// PathChanged and QueryChanged against the previous checkpoint's url.
+func markUrlChanges(emit func(TrackCheckpoint)) func(TrackCheckpoint) {
+	previousUrl := ""
+	return func(checkpoint TrackCheckpoint) {
+		if previousUrl != "" {
+			changes := utils.CompareUrls(previousUrl, checkpoint.Url)
+			checkpoint.HostChanged = changes.Host
+			checkpoint.PathChanged = changes.Path
+			checkpoint.QueryChanged = changes.Query
+		}
+		previousUrl = checkpoint.Url
+		emit(checkpoint)
+	}
+}
+
+func NewTrackerService(fetcher clients.FetcherClient, opts ...TrackerOption) TrackerService {
+	config := trackerConfig{
+		maxBodyBytes:        DefaultMaxBodyBytes,
+		bodyReadTimeout:     DefaultBodyReadTimeout,
+		defaultTimeout:      DefaultTimeout,
+		htmlContentTypes:    utils.DefaultHTMLContentTypes,
+		allowedSchemes:      set.NewFromSlice(DefaultAllowedSchemes),
+		metaRefreshStatuses: set.NewFromSlice(DefaultMetaRefreshStatuses),
+		visitedSetFactory:   set.New[string],
+		clock:               realClock{},
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	return &defaultTrackerService{
 		fetcher: fetcher,
+		config:  config,
 	}
 }
@@ -0,0 +1,667 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"github.com/jorgejr568/wheregoes/internal/pkg/set"
+	"github.com/jorgejr568/wheregoes/internal/utils"
+	"net/http"
+	urlPkg "net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetcherFunc lets a function stand for the fetcher, to track chains without
+// touching the network.
+type fetcherFunc func(ctx context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error) {
+	return f(ctx, request)
+}
+
+// routes answers each url with its response, and any other with a 404.
+func routes(responses map[string]clients.FetcherResponse) fetcherFunc {
+	return func(_ context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error) {
+		if response, ok := responses[request.Url]; ok {
+			return response, nil
+		}
+		return clients.FetcherResponse{StatusCode: http.StatusNotFound}, nil
+	}
+}
+
+func redirect(status int, location string) clients.FetcherResponse {
+	return clients.FetcherResponse{StatusCode: status, Headers: http.Header{"Location": {location}}}
+}
+
+var okResponse = clients.FetcherResponse{StatusCode: http.StatusOK}
+
+// okFetcher answers every url with a 200.
+func okFetcher() fetcherFunc {
+	return func(context.Context, clients.FetcherRequest) (clients.FetcherResponse, error) {
+		return okResponse, nil
+	}
+}
+
+func checkpointUrls(response TrackResponse) []string {
+	urls := make([]string, 0, len(response.Checkpoints))
+	for _, checkpoint := range response.Checkpoints {
+		urls = append(urls, checkpoint.Url)
+	}
+	return urls
+}
+
+func TestTrackReturnsToOrigin(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]clients.FetcherResponse
+		want      bool
+	}{
+		{
+			name: "leaves and comes back",
+			responses: map[string]clients.FetcherResponse{
+				"https://example.com/a":     redirect(http.StatusFound, "https://other.com/b"),
+				"https://other.com/b":       redirect(http.StatusFound, "https://www.example.com/c"),
+				"https://www.example.com/c": okResponse,
+			},
+			want: true,
+		},
+		{
+			name: "leaves for good",
+			responses: map[string]clients.FetcherResponse{
+				"https://example.com/a": redirect(http.StatusFound, "https://other.com/b"),
+				"https://other.com/b":   redirect(http.StatusFound, "https://third.com/c"),
+				"https://third.com/c":   okResponse,
+			},
+			want: false,
+		},
+		{
+			name: "never leaves",
+			responses: map[string]clients.FetcherResponse{
+				"https://example.com/a":     redirect(http.StatusFound, "https://www.example.com/b"),
+				"https://www.example.com/b": okResponse,
+			},
+			want: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := NewTrackerService(routes(test.responses)).Track(context.Background(), "https://example.com/a")
+			if err != nil {
+				t.Fatalf("Track() error = %v", err)
+			}
+			if response.ReturnsToOrigin != test.want {
+				t.Errorf("ReturnsToOrigin = %t for %v, want %t", response.ReturnsToOrigin, checkpointUrls(response), test.want)
+			}
+		})
+	}
+}
+
+// TestTrackParallel is meant to run with -race: a single service is shared by
+// many tracks at once, as the server and batch commands do.
+func TestTrackParallel(t *testing.T) {
+	const tracks = 64
+
+	service := NewTrackerService(routes(map[string]clients.FetcherResponse{
+		"https://example.com/a": redirect(http.StatusMovedPermanently, "/b"),
+		"https://example.com/b": redirect(http.StatusFound, "https://other.com/c"),
+		"https://other.com/c":   okResponse,
+	}), WithCookieGate(), WithCompactChain(1, 1))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, tracks)
+	for i := 0; i < tracks; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var response TrackResponse
+			if i%2 == 0 {
+				var err error
+				if response, err = service.Track(context.Background(), "https://example.com/a"); err != nil {
+					errs <- err
+					return
+				}
+			} else {
+				for message := range service.TrackChannel(context.Background(), "https://example.com/a") {
+					if message.Err != nil {
+						errs <- message.Err
+						return
+					}
+					if message.Finished {
+						response = *message.Response
+					}
+				}
+			}
+			if response.Url != "https://other.com/c" || response.HopCount() != 3 {
+				errs <- fmt.Errorf("tracked to %s in %d hops, want https://other.com/c in 3", response.Url, response.HopCount())
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func panickingFetcher() fetcherFunc {
+	return func(context.Context, clients.FetcherRequest) (clients.FetcherResponse, error) {
+		panic("boom")
+	}
+}
+
+func TestTrackRecoversFromPanics(t *testing.T) {
+	_, err := NewTrackerService(panickingFetcher()).Track(context.Background(), "https://example.com")
+	if !errors.Is(err, ErrTrackerPanic) {
+		t.Errorf("Track() error = %v, want %v", err, ErrTrackerPanic)
+	}
+}
+
+func TestTrackChannelRecoversFromPanics(t *testing.T) {
+	ch := NewTrackerService(panickingFetcher()).TrackChannel(context.Background(), "https://example.com")
+
+	var messages []TrackChannelResponse
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message, ok := <-ch:
+			if ok {
+				messages = append(messages, message)
+				continue
+			}
+			if len(messages) != 1 || !errors.Is(messages[0].Err, ErrTrackerPanic) {
+				t.Errorf("got %+v, want a single message with %v", messages, ErrTrackerPanic)
+			}
+			return
+		case <-timeout:
+			t.Fatal("the channel wasn't closed after the panic")
+		}
+	}
+}
+
+// chainFetcher answers a chain of hops urls, https://example.com/0 redirecting
+// to /1 and so on, the last one answering 200.
+func chainFetcher(hops int) fetcherFunc {
+	responses := make(map[string]clients.FetcherResponse, hops)
+	for i := 0; i < hops-1; i++ {
+		responses[fmt.Sprintf("https://example.com/%d", i)] = redirect(http.StatusFound, fmt.Sprintf("/%d", i+1))
+	}
+	responses[fmt.Sprintf("https://example.com/%d", hops-1)] = okResponse
+	return routes(responses)
+}
+
+// benchmarkHops are the chain lengths Track and TrackChannel are measured
+// on, their sub-benchmarks named alike to compare them side by side.
+var benchmarkHops = []int{1, 5, 30}
+
+func BenchmarkTrack(b *testing.B) {
+	for _, hops := range benchmarkHops {
+		service := NewTrackerService(chainFetcher(hops))
+		b.Run(fmt.Sprintf("hops=%d", hops), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := service.Track(context.Background(), "https://example.com/0"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTrackChannel(b *testing.B) {
+	for _, hops := range benchmarkHops {
+		service := NewTrackerService(chainFetcher(hops))
+		b.Run(fmt.Sprintf("hops=%d", hops), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := collectTrack(service.TrackChannel(context.Background(), "https://example.com/0")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackMaxDomains(t *testing.T) {
+	fetcher := routes(map[string]clients.FetcherResponse{
+		"https://a.com/":     redirect(http.StatusFound, "https://www.a.com/"),
+		"https://www.a.com/": redirect(http.StatusFound, "https://b.com/"),
+		"https://b.com/":     redirect(http.StatusFound, "https://c.com/"),
+		"https://c.com/":     okResponse,
+	})
+
+	if _, err := NewTrackerService(fetcher, WithMaxDomains(3)).Track(context.Background(), "https://a.com/"); err != nil {
+		t.Errorf("Track() with 3 domains allowed, error = %v", err)
+	}
+
+	_, err := NewTrackerService(fetcher, WithMaxDomains(2)).Track(context.Background(), "https://a.com/")
+	if !errors.Is(err, ErrTooManyDomains) {
+		t.Errorf("Track() with 2 domains allowed, error = %v, want %v", err, ErrTooManyDomains)
+	}
+}
+
+func TestTrackDefaults(t *testing.T) {
+	response, err := NewTrackerService(chainFetcher(30)).Track(context.Background(), "https://example.com/0")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if response.Url != "https://example.com/29" || len(response.Checkpoints) != 30 || response.StopReason != "" {
+		t.Errorf("tracked to %s in %d hops (stop reason %q), want all 30 hops followed", response.Url, len(response.Checkpoints), response.StopReason)
+	}
+
+	response, err = NewTrackerService(metaRefreshFetcher()).Track(context.Background(), "https://example.com/page")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if response.Url != "https://example.com/page" {
+		t.Errorf("tracked to %s, want meta refreshes not followed by default", response.Url)
+	}
+}
+
+func TestWithMaxRedirects(t *testing.T) {
+	service := NewTrackerService(chainFetcher(4), WithMaxRedirects(2))
+	if _, err := service.Track(context.Background(), "https://example.com/2"); err != nil {
+		t.Errorf("Track() of 2 redirects error = %v", err)
+	}
+	if _, err := service.Track(context.Background(), "https://example.com/0"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Track() of 3 redirects error = %v, want %v", err, ErrTooManyRedirects)
+	}
+}
+
+// hungFetcher never answers, failing once ctx is done.
+var hungFetcher = fetcherFunc(func(ctx context.Context, _ clients.FetcherRequest) (clients.FetcherResponse, error) {
+	<-ctx.Done()
+	return clients.FetcherResponse{}, ctx.Err()
+})
+
+func TestWithMaxDuration(t *testing.T) {
+	start := time.Now()
+	_, err := NewTrackerService(hungFetcher, WithMaxDuration(50*time.Millisecond)).Track(context.Background(), "https://example.com")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Track() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Track() took %s, want about 50ms", elapsed)
+	}
+}
+
+func metaRefreshFetcher() fetcherFunc {
+	page := clients.FetcherResponse{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": {"text/html"}},
+		Body:       []byte(`<html><head><meta http-equiv="refresh" content="0; url=/next"></head></html>`),
+	}
+	return routes(map[string]clients.FetcherResponse{
+		"https://example.com/page": page,
+		"https://example.com/next": okResponse,
+	})
+}
+
+func TestWithFollowMetaRefresh(t *testing.T) {
+	response, err := NewTrackerService(metaRefreshFetcher(), WithFollowMetaRefresh()).Track(context.Background(), "https://example.com/page")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if response.Url != "https://example.com/next" || response.Checkpoints[0].Note != "meta refresh" {
+		t.Errorf("tracked to %s with checkpoints %+v, want the meta refresh followed", response.Url, response.Checkpoints)
+	}
+}
+
+func TestWithStopAt(t *testing.T) {
+	stopAt := func(url string) bool { return url == "https://example.com/2" }
+	response, err := NewTrackerService(chainFetcher(5), WithStopAt(stopAt)).Track(context.Background(), "https://example.com/0")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	if response.Url != "https://example.com/2" || response.StopReason == "" {
+		t.Errorf("tracked to %s with stop reason %q, want to stop at /2", response.Url, response.StopReason)
+	}
+	if last := response.Checkpoints[len(response.Checkpoints)-1]; last.Status != 0 {
+		t.Errorf("the stop url was fetched, with status %d", last.Status)
+	}
+}
+
+func TestWithVisitedSetFactory(t *testing.T) {
+	created := 0
+	factory := func() set.Set[string] {
+		created++
+		return set.New[string]()
+	}
+	service := NewTrackerService(chainFetcher(3), WithVisitedSetFactory(factory))
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Track(context.Background(), "https://example.com/0"); err != nil {
+			t.Fatalf("Track() error = %v", err)
+		}
+	}
+	if created != 2 {
+		t.Errorf("the factory was called %d times, want once per track", created)
+	}
+}
+
+func TestTrackDefaultTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := NewTrackerService(hungFetcher, WithDefaultTimeout(50*time.Millisecond)).Track(context.Background(), "https://example.com")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Track() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Track() took %s, want about 50ms", elapsed)
+	}
+}
+
+func TestTrackDefaultTimeoutKeepsContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewTrackerService(hungFetcher, WithDefaultTimeout(time.Hour)).Track(ctx, "https://example.com")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Track() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Track() took %s, want about 50ms", elapsed)
+	}
+}
+
+// recordingFetcher wraps fetcher, keeping every request it's sent.
+type recordingFetcher struct {
+	fetcher  clients.FetcherClient
+	mu       sync.Mutex
+	requests []clients.FetcherRequest
+}
+
+func (f *recordingFetcher) Fetch(ctx context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	f.mu.Unlock()
+	return f.fetcher.Fetch(ctx, request)
+}
+
+func (f *recordingFetcher) fetchedUrls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	urls := make([]string, 0, len(f.requests))
+	for _, request := range f.requests {
+		urls = append(urls, request.Url)
+	}
+	return urls
+}
+
+func TestWithSameDomainOnly(t *testing.T) {
+	fetcher := &recordingFetcher{fetcher: routes(map[string]clients.FetcherResponse{
+		"https://example.com/a":     redirect(http.StatusFound, "https://www.example.com/b"),
+		"https://www.example.com/b": redirect(http.StatusFound, "https://tracker.com/c"),
+		"https://tracker.com/c":     okResponse,
+	})}
+
+	response, err := NewTrackerService(fetcher, WithSameDomainOnly()).Track(context.Background(), "https://example.com/a")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	if fetched := fetcher.fetchedUrls(); len(fetched) != 2 || fetched[1] != "https://www.example.com/b" {
+		t.Errorf("fetched %v, want the example.com hops only", fetched)
+	}
+	if urls := checkpointUrls(response); len(urls) != 3 || urls[2] != "https://tracker.com/c" {
+		t.Fatalf("checkpoints = %v, want the tracker.com handoff recorded", urls)
+	}
+	if handoff := response.Checkpoints[2]; handoff.Status != 0 || handoff.Note != "other domain, not fetched" {
+		t.Errorf("handoff checkpoint = %+v, want it unfetched with a note", handoff)
+	}
+	if response.Url != "https://tracker.com/c" || response.StopReason == "" {
+		t.Errorf("tracked to %s with stop reason %q, want to stop at the handoff", response.Url, response.StopReason)
+	}
+}
+
+func FuzzTransformLocationUrl(f *testing.F) {
+	for _, location := range []string{
+		"/next", "next", "../up", "//other.com/x", "?q=1", "#top", "https://a.com/b", "HTTP://A.COM",
+		"http://", "https://:80", "", "  ", "%zz", "http://[::1", "mailto:a@b.c", "javascript:alert(1)",
+		"https://a.com/ spaced", "\x00", "//", "///x",
+	} {
+		f.Add(location, "https://example.com/a/b?c=d")
+	}
+	f.Add("/x", "not a url")
+	f.Add("/x", "http://[::1")
+
+	service := NewTrackerService(okFetcher()).(*defaultTrackerService)
+	f.Fuzz(func(t *testing.T, location string, previousUrl string) {
+		nextUrl := service.transformLocationUrl(location, previousUrl)
+		if nextUrl == "" {
+			return
+		}
+
+		// Urls of other schemes are recorded as destinations, as is.
+		if scheme := utils.UrlScheme(strings.TrimSpace(location)); scheme != "" && scheme != "http" && scheme != "https" {
+			if nextUrl != strings.TrimSpace(location) {
+				t.Errorf("transformLocationUrl(%q, %q) = %q, want the %s: url as is", location, previousUrl, nextUrl, scheme)
+			}
+			return
+		}
+
+		parsedUrl, err := urlPkg.Parse(nextUrl)
+		if err != nil {
+			t.Fatalf("transformLocationUrl(%q, %q) = %q, which doesn't parse: %v", location, previousUrl, nextUrl, err)
+		}
+		if (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+			t.Errorf("transformLocationUrl(%q, %q) = %q, want an http(s) url with a host", location, previousUrl, nextUrl)
+		}
+	})
+}
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// latencyFetcher wraps fetcher, advancing clock by latencies[url] for each
+// fetch, as if it took that long.
+func latencyFetcher(clock *fakeClock, fetcher clients.FetcherClient, latencies map[string]time.Duration) fetcherFunc {
+	return func(ctx context.Context, request clients.FetcherRequest) (clients.FetcherResponse, error) {
+		clock.Advance(latencies[request.Url])
+		return fetcher.Fetch(ctx, request)
+	}
+}
+
+// collectTrack reads every message of a TrackChannel, returning the
+// checkpoints sent and the error, if any.
+func collectTrack(ch <-chan TrackChannelResponse) (checkpoints []TrackCheckpoint, err error) {
+	for message := range ch {
+		switch {
+		case message.Err != nil:
+			err = message.Err
+		case message.Checkpoint != nil:
+			checkpoints = append(checkpoints, *message.Checkpoint)
+		}
+	}
+	return checkpoints, err
+}
+
+func TestWithTotalLatencyBudget(t *testing.T) {
+	clock := newFakeClock()
+	fetcher := latencyFetcher(clock, chainFetcher(4), map[string]time.Duration{
+		"https://example.com/0": 40 * time.Millisecond,
+		"https://example.com/1": 40 * time.Millisecond,
+		"https://example.com/2": 40 * time.Millisecond,
+		"https://example.com/3": 40 * time.Millisecond,
+	})
+	service := NewTrackerService(fetcher, WithClock(clock), WithTotalLatencyBudget(100*time.Millisecond))
+
+	checkpoints, err := collectTrack(service.TrackChannel(context.Background(), "https://example.com/0"))
+	if !errors.Is(err, ErrChainOverBudget) {
+		t.Fatalf("TrackChannel() error = %v, want %v", err, ErrChainOverBudget)
+	}
+	if len(checkpoints) != 3 || checkpoints[2].Url != "https://example.com/2" {
+		t.Errorf("got %d checkpoints, want the 3 up to the one going over the budget", len(checkpoints))
+	}
+
+	response, err := service.Track(context.Background(), "https://example.com/0")
+	if !errors.Is(err, ErrChainOverBudget) {
+		t.Errorf("Track() error = %v, want %v", err, ErrChainOverBudget)
+	}
+	assertPartialChain(t, response, err, "https://example.com/2", 3)
+	if _, err := service.Track(context.Background(), "https://example.com/2"); err != nil {
+		t.Errorf("Track() of a chain within the budget error = %v", err)
+	}
+}
+
+func TestWithHopBudget(t *testing.T) {
+	clock := newFakeClock()
+	fetcher := latencyFetcher(clock, chainFetcher(3), map[string]time.Duration{
+		"https://example.com/0": 10 * time.Millisecond,
+		"https://example.com/1": 60 * time.Millisecond,
+		"https://example.com/2": 10 * time.Millisecond,
+	})
+	service := NewTrackerService(fetcher, WithClock(clock), WithHopBudget(50*time.Millisecond))
+
+	response, err := service.Track(context.Background(), "https://example.com/0")
+	if !errors.Is(err, ErrHopOverBudget) {
+		t.Fatalf("Track() error = %v, want %v", err, ErrHopOverBudget)
+	}
+	assertPartialChain(t, response, err, "https://example.com/1", 2)
+
+	var partial *TrackResponse
+	for message := range service.TrackChannel(context.Background(), "https://example.com/0") {
+		if message.Err != nil {
+			partial = message.Response
+		}
+	}
+	if partial == nil {
+		t.Fatal("TrackChannel() sent no partial chain with the error")
+	}
+	assertPartialChain(t, *partial, err, "https://example.com/1", 2)
+}
+
+// assertPartialChain checks response is the chain of hops checkpoints ending
+// at url, the hop going over a budget, stopped for err.
+func assertPartialChain(t *testing.T, response TrackResponse, err error, url string, hops int) {
+	t.Helper()
+
+	if !IsPartialChainError(err) {
+		t.Errorf("IsPartialChainError(%v) = false", err)
+	}
+	if len(response.Checkpoints) != hops || response.Url != url {
+		t.Fatalf("the partial chain is %v ending at %q, want %d hops up to %s", checkpointUrls(response), response.Url, hops, url)
+	}
+	if last := response.Checkpoints[hops-1]; last.Url != url || last.Latency == 0 {
+		t.Errorf("the last checkpoint is %+v, want the hop going over the budget", last)
+	}
+	if response.StopReason != err.Error() {
+		t.Errorf("StopReason = %q, want %q", response.StopReason, err.Error())
+	}
+}
+
+func TestTrackMarksUrlChanges(t *testing.T) {
+	response, err := NewTrackerService(routes(map[string]clients.FetcherResponse{
+		"https://a.com/x":                 redirect(http.StatusFound, "/x?utm_source=mail"),
+		"https://a.com/x?utm_source=mail": redirect(http.StatusFound, "/y?utm_source=mail"),
+		"https://a.com/y?utm_source=mail": redirect(http.StatusFound, "https://b.com/y?utm_source=mail"),
+		"https://b.com/y?utm_source=mail": okResponse,
+	})).Track(context.Background(), "https://a.com/x")
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	want := [][3]bool{
+		{false, false, false},
+		{false, false, true},
+		{false, true, false},
+		{true, false, false},
+	}
+	if len(response.Checkpoints) != len(want) {
+		t.Fatalf("got %d checkpoints, want %d", len(response.Checkpoints), len(want))
+	}
+	for i, checkpoint := range response.Checkpoints {
+		got := [3]bool{checkpoint.HostChanged, checkpoint.PathChanged, checkpoint.QueryChanged}
+		if got != want[i] {
+			t.Errorf("checkpoint %d (%s) host, path and query changed = %v, want %v", i, checkpoint.Url, got, want[i])
+		}
+	}
+}
+
+func TestTrackSeveralLocationHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations []string
+		want      string
+	}{
+		{"both valid", []string{"https://b.com/first", "https://c.com/second"}, "https://b.com/first"},
+		{"empty first", []string{"", "https://c.com/second"}, "https://c.com/second"},
+		{"blank first", []string{"  ", "https://c.com/second"}, "https://c.com/second"},
+		{"malformed first", []string{"http://[::1", "https://c.com/second"}, "https://c.com/second"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := NewTrackerService(routes(map[string]clients.FetcherResponse{
+				"https://a.com": {StatusCode: http.StatusFound, Headers: http.Header{"Location": test.locations}},
+				test.want:       okResponse,
+			})).Track(context.Background(), "https://a.com")
+			if err != nil {
+				t.Fatalf("Track() error = %v", err)
+			}
+
+			if response.Url != test.want {
+				t.Errorf("Track() ended on %v, want %s followed", checkpointUrls(response), test.want)
+			}
+			if note := response.Checkpoints[0].Note; !strings.Contains(note, "2 Location headers, possible header injection") {
+				t.Errorf("the redirect's note = %q, want the Location headers counted", note)
+			}
+		})
+	}
+}
+
+func TestTrackRepairsLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+		repaired bool
+	}{
+		{"/a b", "https://a.com/a%20b", true},
+		{"https://b.com/{id}", "https://b.com/%7Bid%7D", true},
+		{"https://b.com/café", "https://b.com/caf%C3%A9", true},
+		{"https://b.com/a%20b", "https://b.com/a%20b", false},
+	}
+	for _, test := range tests {
+		t.Run(test.location, func(t *testing.T) {
+			fetcher := &recordingFetcher{fetcher: routes(map[string]clients.FetcherResponse{
+				"https://a.com": redirect(http.StatusFound, test.location),
+				test.want:       okResponse,
+			})}
+			response, err := NewTrackerService(fetcher).Track(context.Background(), "https://a.com")
+			if err != nil {
+				t.Fatalf("Track() error = %v", err)
+			}
+
+			if urls := fetcher.fetchedUrls(); len(urls) != 2 || urls[1] != test.want {
+				t.Errorf("fetched %v, want %s next", urls, test.want)
+			}
+			if noted := strings.Contains(response.Checkpoints[0].Note, "Location percent-encoded"); noted != test.repaired {
+				t.Errorf("the redirect's note = %q, want the repair noted: %t", response.Checkpoints[0].Note, test.repaired)
+			}
+		})
+	}
+}
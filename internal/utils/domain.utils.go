@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"net"
+	urlPkg "net/url"
+	"strings"
+)
+
+// RegistrableDomain returns the eTLD+1 of the url's host (e.g. "example.co.uk"
+// for "https://www.example.co.uk/path"). Hosts that have no registrable domain,
+// like IP addresses or "localhost", are returned as is. An empty string is
+// returned when the url can't be parsed.
+func RegistrableDomain(url string) string {
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsedUrl.Hostname())
+	if host == "" {
+		return ""
+	}
+
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+
+	return domain
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// DefaultHTMLContentTypes are the content types whose bodies are parsed as HTML.
+var DefaultHTMLContentTypes = []string{"text/html", "application/xhtml+xml"}
+
+// MatchesContentType reports whether the media type of a Content-Type header
+// value is one of contentTypes, ignoring parameters like charset.
+func MatchesContentType(header string, contentTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+
+	for _, contentType := range contentTypes {
+		if strings.EqualFold(mediaType, contentType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HTMLDocument holds what the tracker reads from a page's HTML.
+type HTMLDocument struct {
+	Title string
+	// CanonicalUrl and OgUrl come from <link rel="canonical"> and
+	// <meta property="og:url">, resolved against the page url.
+	CanonicalUrl string
+	OgUrl        string
+	// RefreshUrl is the destination of a <meta http-equiv="refresh">, resolved
+	// against the page url.
+	RefreshUrl string
+	// ScriptUrl is the destination of an inline script redirect, like
+	// location.href = "/next" or location.replace("/next"), resolved against
+	// the page url. Only string literals are recognized.
+	ScriptUrl string
+}
+
+// scriptRedirectRegex matches assignments of a string literal to location or
+// location.href, and calls to location.replace or location.assign with one.
+var scriptRedirectRegex = regexp.MustCompile(
+	`\blocation(?:\.href)?\s*=\s*(?:"([^"]*)"|'([^']*)')|\blocation\.(?:replace|assign)\(\s*(?:"([^"]*)"|'([^']*)')\s*\)`,
+)
+
+// ParseHTML reads an HTML document in a single pass, keeping the first
+// occurrence of each field. pageUrl resolves relative references. It's the
+// single place the tracker reads HTML from, whatever feature needs it.
+func ParseHTML(body []byte, pageUrl string) HTMLDocument {
+	var document HTMLDocument
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return document
+		}
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		switch token.Data {
+		case "title":
+			if document.Title == "" && tokenType == html.StartTagToken && tokenizer.Next() == html.TextToken {
+				document.Title = strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+		case "link":
+			if document.CanonicalUrl == "" && hasToken(attr(token, "rel"), "canonical") {
+				document.CanonicalUrl = ResolveReference(pageUrl, attr(token, "href"))
+			}
+		case "meta":
+			if document.OgUrl == "" && strings.EqualFold(attr(token, "property"), "og:url") {
+				document.OgUrl = ResolveReference(pageUrl, attr(token, "content"))
+			}
+			if document.RefreshUrl == "" && strings.EqualFold(attr(token, "http-equiv"), "refresh") {
+				document.RefreshUrl = ParseRefresh(attr(token, "content"), pageUrl)
+			}
+		case "script":
+			if document.ScriptUrl == "" && tokenType == html.StartTagToken && attr(token, "src") == "" &&
+				tokenizer.Next() == html.TextToken {
+				document.ScriptUrl = ResolveReference(pageUrl, scriptRedirectUrl(tokenizer.Text()))
+			}
+		}
+	}
+}
+
+// ParseRefresh returns the url of a refresh directive like "0; url='/next'",
+// as found in a Refresh header or a meta refresh, resolved against pageUrl.
+// It returns an empty string when there's none.
+func ParseRefresh(content string, pageUrl string) string {
+	return ResolveReference(pageUrl, refreshUrl(content))
+}
+
+// scriptRedirectUrl returns the url of the first script redirect in script,
+// or an empty string when there's none.
+func scriptRedirectUrl(script []byte) string {
+	match := scriptRedirectRegex.FindSubmatch(script)
+	if match == nil {
+		return ""
+	}
+
+	for _, group := range match[1:] {
+		if len(group) > 0 {
+			return string(group)
+		}
+	}
+	return ""
+}
+
+func refreshUrl(content string) string {
+	_, target, found := strings.Cut(content, ";")
+	if !found {
+		_, target, found = strings.Cut(content, ",")
+		if !found {
+			return ""
+		}
+	}
+
+	target = strings.TrimSpace(target)
+	if len(target) >= 4 && strings.EqualFold(target[:4], "url=") {
+		target = strings.TrimSpace(target[4:])
+	}
+
+	return strings.Trim(target, `"'`)
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the space-separated list value contains token.
+func hasToken(value string, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet returns a printable excerpt of at most maxBytes of body: invalid
+// UTF-8 and control characters are dropped, runs of whitespace become a single
+// space, and "..." marks an excerpt that was cut short.
+func Snippet(body []byte, maxBytes int) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range strings.ToValidUTF8(string(body), "") {
+		switch {
+		case unicode.IsSpace(r):
+			space = builder.Len() > 0
+			continue
+		case !unicode.IsPrint(r):
+			continue
+		}
+
+		size := utf8.RuneLen(r)
+		if space {
+			size++
+		}
+		if builder.Len()+size > maxBytes {
+			return builder.String() + "..."
+		}
+
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -1,9 +1,245 @@
 package utils
 
-import "regexp"
+import (
+	urlPkg "net/url"
+	"regexp"
+	"strings"
+)
 
 var urlRegex = regexp.MustCompile(`^https?://`)
+var schemeRegex = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
 
 func IsUrl(url string) bool {
 	return urlRegex.MatchString(url)
 }
+
+// UrlScheme returns the lowercased scheme of url ("mailto" for
+// "mailto:a@b.c"), or an empty string for relative references.
+func UrlScheme(url string) string {
+	match := schemeRegex.FindStringSubmatch(url)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// NormalizeUrl returns a form of url suited for comparing hops. The fragment is
+// always dropped, since it's never sent to the server, and scheme and host are
+// lowercased. When trimTrailingSlash is set, "/a/" and "/a" (and "" and "/")
+// normalize to the same path. Urls that can't be parsed are returned as is.
+func NormalizeUrl(url string, trimTrailingSlash bool) string {
+	if !trimTrailingSlash && isNormalized(url) {
+		return url
+	}
+
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return url
+	}
+
+	parsedUrl.Fragment = ""
+	parsedUrl.RawFragment = ""
+	parsedUrl.Scheme = strings.ToLower(parsedUrl.Scheme)
+	parsedUrl.Host = strings.ToLower(parsedUrl.Host)
+
+	if trimTrailingSlash {
+		parsedUrl.Path = strings.TrimRight(parsedUrl.Path, "/")
+		parsedUrl.RawPath = strings.TrimRight(parsedUrl.RawPath, "/")
+		if parsedUrl.Path == "" {
+			parsedUrl.Path = "/"
+			parsedUrl.RawPath = ""
+		}
+	}
+
+	return parsedUrl.String()
+}
+
+// isNormalized cheaply checks whether url has no fragment and a lowercase
+// scheme and authority, so NormalizeUrl can skip parsing it.
+func isNormalized(url string) bool {
+	if strings.ContainsRune(url, '#') {
+		return false
+	}
+
+	authorityEnd := len(url)
+	if i := strings.Index(url, "://"); i >= 0 {
+		if j := strings.IndexAny(url[i+3:], "/?"); j >= 0 {
+			authorityEnd = i + 3 + j
+		}
+	}
+
+	return strings.ToLower(url[:authorityEnd]) == url[:authorityEnd]
+}
+
+// AddQueryParams appends params to url's query string. Existing parameters are
+// kept untouched, so a key already present ends up with both values.
+func AddQueryParams(url string, params urlPkg.Values) (string, error) {
+	if len(params) == 0 {
+		return url, nil
+	}
+
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil {
+		return "", err
+	}
+
+	if parsedUrl.RawQuery == "" {
+		parsedUrl.RawQuery = params.Encode()
+	} else {
+		parsedUrl.RawQuery += "&" + params.Encode()
+	}
+
+	return parsedUrl.String(), nil
+}
+
+// ResolveReference resolves ref against baseUrl, returning an empty string
+// when either can't be parsed or ref is empty.
+func ResolveReference(baseUrl string, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	parsedBaseUrl, err := urlPkg.Parse(baseUrl)
+	if err != nil {
+		return ""
+	}
+
+	parsedRef, err := urlPkg.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	return parsedBaseUrl.ResolveReference(parsedRef).String()
+}
+
+// UrlChanges tells which parts of a url changed from one hop to the next.
+type UrlChanges struct {
+	Host  bool
+	Path  bool
+	Query bool
+}
+
+// CompareUrls reports which of the host, path and query of to differ from
+// from's. Hosts are compared case-insensitively along with their port, and an
+// empty path equals "/". Urls that can't be parsed count as entirely changed.
+func CompareUrls(from string, to string) UrlChanges {
+	parsedFrom, err := urlPkg.Parse(from)
+	if err != nil {
+		return UrlChanges{Host: true, Path: true, Query: true}
+	}
+
+	parsedTo, err := urlPkg.Parse(to)
+	if err != nil {
+		return UrlChanges{Host: true, Path: true, Query: true}
+	}
+
+	return UrlChanges{
+		Host:  !strings.EqualFold(parsedFrom.Host, parsedTo.Host),
+		Path:  comparablePath(parsedFrom) != comparablePath(parsedTo),
+		Query: parsedFrom.RawQuery != parsedTo.RawQuery,
+	}
+}
+
+func comparablePath(url *urlPkg.URL) string {
+	if url.Opaque != "" {
+		return url.Opaque
+	}
+	if path := url.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// TrackingParams are query parameters added for analytics, which don't change
+// where a url leads. Parameters starting with "utm_" are tracking ones too.
+var TrackingParams = []string{"fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid"}
+
+// IsTrackingParam reports whether the query parameter key is a tracking one.
+func IsTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+
+	for _, param := range TrackingParams {
+		if key == param {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTrackingParams removes tracking query parameters from url, keeping the
+// others as they were. Urls that can't be parsed are returned as is.
+func StripTrackingParams(url string) string {
+	parsedUrl, err := urlPkg.Parse(url)
+	if err != nil || parsedUrl.RawQuery == "" {
+		return url
+	}
+
+	pairs := strings.Split(parsedUrl.RawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if unescapedKey, err := urlPkg.QueryUnescape(key); err == nil {
+			key = unescapedKey
+		}
+		if !IsTrackingParam(key) {
+			kept = append(kept, pair)
+		}
+	}
+
+	parsedUrl.RawQuery = strings.Join(kept, "&")
+	return parsedUrl.String()
+}
+
+// RepairUrl percent-encodes the characters of url that must be encoded but
+// that misbehaving servers send raw, like spaces, quotes, "{" and non-ASCII
+// bytes, along with "%" signs not starting an escape, the way browsers
+// tolerate them. Surrounding whitespace is trimmed. It returns url as is when
+// there's nothing to repair.
+func RepairUrl(url string) string {
+	url = strings.TrimSpace(url)
+
+	var repaired strings.Builder
+	for i := 0; i < len(url); i++ {
+		c := url[i]
+		if !needsEscaping(c) && (c != '%' || isEscape(url[i:])) {
+			if repaired.Len() > 0 {
+				repaired.WriteByte(c)
+			}
+			continue
+		}
+
+		if repaired.Len() == 0 {
+			repaired.Grow(len(url) + 8)
+			repaired.WriteString(url[:i])
+		}
+		repaired.WriteByte('%')
+		repaired.WriteByte(upperHex[c>>4])
+		repaired.WriteByte(upperHex[c&15])
+	}
+
+	if repaired.Len() == 0 {
+		return url
+	}
+	return repaired.String()
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// needsEscaping reports whether c is never valid raw in a url: control
+// characters, spaces, non-ASCII bytes and the characters browsers encode in
+// paths and queries.
+func needsEscaping(c byte) bool {
+	return c <= ' ' || c >= 0x7f || strings.IndexByte("\"<>`{}|^", c) >= 0
+}
+
+// isEscape reports whether s starts with a "%XX" escape.
+func isEscape(s string) bool {
+	return len(s) >= 3 && isHex(s[1]) && isHex(s[2])
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,90 @@
+package utils
+
+import "testing"
+
+func TestNormalizeUrl(t *testing.T) {
+	tests := []struct {
+		name              string
+		a, b              string
+		trimTrailingSlash bool
+		same              bool
+	}{
+		{"fragment only", "https://example.com/a#top", "https://example.com/a#bottom", false, true},
+		{"fragment against none", "https://example.com/a#top", "https://example.com/a", false, true},
+		{"fragment only, trimming slashes", "https://example.com/a/#top", "https://example.com/a#bottom", true, true},
+		{"trailing slash", "https://example.com/a/", "https://example.com/a", false, false},
+		{"trailing slash, trimming slashes", "https://example.com/a/", "https://example.com/a", true, true},
+		{"empty path, trimming slashes", "https://example.com", "https://example.com/", true, true},
+		{"scheme and host case", "HTTPS://Example.COM/a", "https://example.com/a", false, true},
+		{"path case", "https://example.com/A", "https://example.com/a", false, false},
+		{"query", "https://example.com/a?b=1#c", "https://example.com/a?b=2#c", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NormalizeUrl(test.a, test.trimTrailingSlash)
+			b := NormalizeUrl(test.b, test.trimTrailingSlash)
+			if (a == b) != test.same {
+				t.Errorf("NormalizeUrl(%q) = %q and NormalizeUrl(%q) = %q, want them equal: %t", test.a, a, test.b, b, test.same)
+			}
+		})
+	}
+}
+
+func TestNormalizeUrlDropsFragment(t *testing.T) {
+	for _, trimTrailingSlash := range []bool{false, true} {
+		if got := NormalizeUrl("https://example.com/a?b=1#c", trimTrailingSlash); got != "https://example.com/a?b=1" {
+			t.Errorf("NormalizeUrl(trimTrailingSlash: %t) = %q, want %q", trimTrailingSlash, got, "https://example.com/a?b=1")
+		}
+	}
+}
+
+func TestCompareUrls(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     UrlChanges
+	}{
+		{"same url", "https://a.com/x?q=1", "https://a.com/x?q=1", UrlChanges{}},
+		{"host only", "https://a.com/x?q=1", "https://b.com/x?q=1", UrlChanges{Host: true}},
+		{"port", "https://a.com/x", "https://a.com:8443/x", UrlChanges{Host: true}},
+		{"host case", "https://A.com/x", "https://a.COM/x", UrlChanges{}},
+		{"path only", "https://a.com/x?q=1", "https://a.com/y?q=1", UrlChanges{Path: true}},
+		{"empty path", "https://a.com", "https://a.com/", UrlChanges{}},
+		{"query only", "https://a.com/x", "https://a.com/x?utm_source=mail", UrlChanges{Query: true}},
+		{"fragment only", "https://a.com/x#a", "https://a.com/x#b", UrlChanges{}},
+		{"everything", "https://a.com/x?q=1", "http://b.com/y?q=2", UrlChanges{Host: true, Path: true, Query: true}},
+		{"malformed", "https://a.com/x", "http://[::1", UrlChanges{Host: true, Path: true, Query: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CompareUrls(test.from, test.to); got != test.want {
+				t.Errorf("CompareUrls(%q, %q) = %+v, want %+v", test.from, test.to, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRepairUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"space", "https://a.com/a b?q=c d", "https://a.com/a%20b?q=c%20d"},
+		{"surrounding spaces", " https://a.com/a ", "https://a.com/a"},
+		{"braces", "https://a.com/{id}", "https://a.com/%7Bid%7D"},
+		{"stray percent", "https://a.com/100%?off=5%2", "https://a.com/100%25?off=5%252"},
+		{"escape kept", "https://a.com/a%20b%2F", "https://a.com/a%20b%2F"},
+		{"non-ASCII", "https://a.com/café", "https://a.com/caf%C3%A9"},
+		{"control character", "https://a.com/a\tb", "https://a.com/a%09b"},
+		{"already valid", "https://a.com/a/b?c=d&e=f#g", "https://a.com/a/b?c=d&e=f#g"},
+		{"relative", "/a b", "/a%20b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RepairUrl(test.url); got != test.want {
+				t.Errorf("RepairUrl(%q) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
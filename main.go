@@ -1,10 +1,19 @@
 package main
 
-import "github.com/jorgejr568/wheregoes/internal/cmd"
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/cmd"
+	"os"
+	"os/signal"
+)
 
 func main() {
-	err := cmd.RootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := cmd.RootCmd.ExecuteContext(ctx)
 	if err != nil {
-		return
+		stop()
+		os.Exit(cmd.ExitCodeOf(err))
 	}
 }
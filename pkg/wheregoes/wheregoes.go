@@ -0,0 +1,153 @@
+// Package wheregoes tracks where a url redirects to. It's the public face of
+// the tracker used by the wheregoes CLI and server, for embedding in other
+// programs:
+//
+//	response, err := wheregoes.Track(ctx, "https://maps.google.com")
+package wheregoes
+
+import (
+	"context"
+	"github.com/jorgejr568/wheregoes/internal/clients"
+	"github.com/jorgejr568/wheregoes/internal/pkg/set"
+	"github.com/jorgejr568/wheregoes/internal/services"
+)
+
+type (
+	TrackerService       = services.TrackerService
+	TrackResponse        = services.TrackResponse
+	TrackCheckpoint      = services.TrackCheckpoint
+	HopRequest           = services.HopRequest
+	TrackChannelResponse = services.TrackChannelResponse
+	TrackerOption        = services.TrackerOption
+	RedirectType         = services.RedirectType
+	AuthForwarding       = services.AuthForwarding
+	ServerTiming         = services.ServerTiming
+	Headers              = services.Headers
+	// Clock tells the time latencies are measured with, see WithClock.
+	Clock = services.Clock
+	// VisitedSet is the set of urls a track visited, see WithVisitedSetFactory.
+	VisitedSet = set.Set[string]
+
+	FetcherClient   = clients.FetcherClient
+	FetcherRequest  = clients.FetcherRequest
+	FetcherResponse = clients.FetcherResponse
+	FetcherOption   = clients.FetcherOption
+	// ShortUrlResolver expands short urls with their shortener's API, see
+	// WithShortUrlResolvers.
+	ShortUrlResolver = clients.ShortUrlResolver
+)
+
+const (
+	RedirectTypePermanent = services.RedirectTypePermanent
+	RedirectTypeTemporary = services.RedirectTypeTemporary
+
+	AuthForwardingSameHost = services.AuthForwardingSameHost
+	AuthForwardingNever    = services.AuthForwardingNever
+	AuthForwardingAlways   = services.AuthForwardingAlways
+
+	DefaultMaxBodyBytes    = services.DefaultMaxBodyBytes
+	DefaultBodyReadTimeout = services.DefaultBodyReadTimeout
+	DefaultTimeout         = services.DefaultTimeout
+	DefaultUserAgent       = clients.DefaultUserAgent
+	DefaultAccept          = clients.DefaultAccept
+	DefaultMaxHeaderBytes  = clients.DefaultMaxHeaderBytes
+	DefaultMaxHeaders      = clients.DefaultMaxHeaders
+	DefaultIdleConnTimeout = clients.DefaultIdleConnTimeout
+)
+
+var (
+	ErrCircularRedirection = services.ErrCircularRedirection
+	ErrTrackerPanic        = services.ErrTrackerPanic
+	ErrInvalidUrl          = services.ErrInvalidUrl
+	ErrTooManyDomains      = services.ErrTooManyDomains
+	ErrTooManyRedirects    = services.ErrTooManyRedirects
+	ErrHopOverBudget       = services.ErrHopOverBudget
+	ErrChainOverBudget     = services.ErrChainOverBudget
+
+	DefaultAllowedSchemes      = services.DefaultAllowedSchemes
+	DefaultMetaRefreshStatuses = services.DefaultMetaRefreshStatuses
+)
+
+// Tracker options, see the TrackerOption constructors of the same name.
+var (
+	WithTrailingSlashNormalization = services.WithTrailingSlashNormalization
+	WithFollowOnly                 = services.WithFollowOnly
+	WithErrorBodyCapture           = services.WithErrorBodyCapture
+	WithHeaderCapture              = services.WithHeaderCapture
+	WithRequestCapture             = services.WithRequestCapture
+	WithClock                      = services.WithClock
+	WithMaxBodyBytes               = services.WithMaxBodyBytes
+	WithBodyReadTimeout            = services.WithBodyReadTimeout
+	WithHTMLContentTypes           = services.WithHTMLContentTypes
+	WithInitialRequest             = services.WithInitialRequest
+	WithFinalTitle                 = services.WithFinalTitle
+	WithSEO                        = services.WithSEO
+	WithAllowedSchemes             = services.WithAllowedSchemes
+	WithAllowedPorts               = services.WithAllowedPorts
+	WithSlowThreshold              = services.WithSlowThreshold
+	WithHopBudget                  = services.WithHopBudget
+	WithTotalLatencyBudget         = services.WithTotalLatencyBudget
+	WithMaxDomains                 = services.WithMaxDomains
+	WithCookieGate                 = services.WithCookieGate
+	WithMaxRedirects               = services.WithMaxRedirects
+	WithDefaultTimeout             = services.WithDefaultTimeout
+	WithMaxDuration                = services.WithMaxDuration
+	WithFollowMetaRefresh          = services.WithFollowMetaRefresh
+	WithMetaRefreshStatuses        = services.WithMetaRefreshStatuses
+	WithStopAt                     = services.WithStopAt
+	WithSameDomainOnly             = services.WithSameDomainOnly
+	WithReferer                    = services.WithReferer
+	WithRefererChain               = services.WithRefererChain
+	WithVisitedSetFactory          = services.WithVisitedSetFactory
+	WithInitialHeaders             = services.WithInitialHeaders
+	WithBasicAuth                  = services.WithBasicAuth
+	WithHopDelay                   = services.WithHopDelay
+	WithInjectedHop                = services.WithInjectedHop
+	WithCompactChain               = services.WithCompactChain
+)
+
+// Fetcher options, see NewHttpFetcherClient.
+var (
+	WithProxy             = clients.WithProxy
+	WithProxies           = clients.WithProxies
+	WithPerHostRateLimit  = clients.WithPerHostRateLimit
+	WithTimeout           = clients.WithTimeout
+	WithUserAgent         = clients.WithUserAgent
+	WithAccept            = clients.WithAccept
+	WithInsecureTLS       = clients.WithInsecureTLS
+	WithHTTP1Only         = clients.WithHTTP1Only
+	WithoutKeepAlives     = clients.WithoutKeepAlives
+	WithIdleConnTimeout   = clients.WithIdleConnTimeout
+	WithLocalAddr         = clients.WithLocalAddr
+	WithMaxHeaderBytes    = clients.WithMaxHeaderBytes
+	WithMaxHeaders        = clients.WithMaxHeaders
+	WithShortUrlResolvers = clients.WithShortUrlResolvers
+)
+
+var (
+	RedirectTypeOf      = services.RedirectTypeOf
+	IsRedirectStatus    = services.IsRedirectStatus
+	ParseRedirectType   = services.ParseRedirectType
+	ParseAuthForwarding = services.ParseAuthForwarding
+	NewBitlyResolver    = clients.NewBitlyResolver
+	NewHeaders          = services.NewHeaders
+	NativeFinalUrl      = clients.NativeFinalUrl
+	IsPartialChainError = services.IsPartialChainError
+)
+
+// NewHttpFetcherClient returns the HTTP client trackers fetch hops with.
+func NewHttpFetcherClient(opts ...FetcherOption) FetcherClient {
+	return clients.NewHttpFetcherClient(opts...)
+}
+
+// NewTrackerService returns a tracker fetching hops with fetcher. It's safe
+// for concurrent use and meant to be shared.
+func NewTrackerService(fetcher FetcherClient, opts ...TrackerOption) TrackerService {
+	return services.NewTrackerService(fetcher, opts...)
+}
+
+// Track follows the redirect chain starting at url with a default HTTP
+// fetcher. Programs tracking many urls should share a TrackerService instead.
+func Track(ctx context.Context, url string, opts ...TrackerOption) (TrackResponse, error) {
+	return NewTrackerService(NewHttpFetcherClient(), opts...).Track(ctx, url)
+}